@@ -4,6 +4,11 @@ import (
 	"context"
 	"github.com/afzalabbasi/message-service/auth-service/internal/api"
 	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	"github.com/afzalabbasi/message-service/auth-service/internal/kafka"
+	"github.com/afzalabbasi/message-service/auth-service/internal/keys"
+	"github.com/afzalabbasi/message-service/auth-service/internal/mail"
+	"github.com/afzalabbasi/message-service/auth-service/internal/middleware"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
 	"github.com/afzalabbasi/message-service/auth-service/internal/service"
 	"log"
 	"net/http"
@@ -20,9 +25,37 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Set up Kafka producer for user events
+	kafkaProducer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create Kafka producer: %v", err)
+	}
+	defer kafkaProducer.Close()
+
+	// Background tasks run until the server shuts down
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Load the token signing keys and pick up rotated ones in the background
+	keyManager, err := keys.NewManager(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	go keyManager.Watch(bgCtx, cfg.JWTKeysReloadInterval)
+
+	// Set up the mailer for verification and password reset emails
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+
 	// Initialize services
-	authService := service.NewAuthService(cfg)
-	handler := api.NewHandler(authService)
+	jwtMiddleware := middleware.NewJWTMiddleware(keyManager, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTLeeway)
+	authService := service.NewAuthService(cfg, jwtMiddleware, kafkaProducer, mailer, oidc.NewProviders(cfg.OIDCProviders))
+	handler := api.NewHandler(authService, jwtMiddleware, cfg.TrustedProxies)
+
+	// Forget expired login attempts in the background
+	go authService.PruneLoginAttempts(bgCtx, time.Hour)
 
 	// Configure server
 	server := &http.Server{
@@ -7,5 +7,16 @@ require (
 	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	github.com/segmentio/kafka-go v0.4.47
 	golang.org/x/crypto v0.37.0
 )
+
+require golang.org/x/sys v0.32.0 // indirect
+
+require (
+	github.com/afzalabbasi/message-service/pkg v0.0.0
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace github.com/afzalabbasi/message-service/pkg => ../pkg
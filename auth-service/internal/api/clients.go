@@ -0,0 +1,122 @@
+// internal/api/clients.go
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/service"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// Token issues machine tokens with the OAuth 2.0 client credentials grant. Requests are
+// form encoded and errors use the OAuth error format, so standard OAuth clients work.
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Credentials may be sent with HTTP Basic authentication or in the form
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || secret == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	resp, err := h.authService.IssueClientToken(r.Context(), clientID, secret, strings.Fields(r.PostForm.Get("scope")))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidClient):
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		case errors.Is(err, service.ErrInvalidScope):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope")
+		default:
+			log.Printf("Error issuing token to client %s: %v", clientID, err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeOAuthError writes an OAuth 2.0 error response
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// CreateServiceClient registers a service client on behalf of an admin
+func (h *Handler) CreateServiceClient(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.CreateServiceClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.Name == "" || len(req.Name) > 50 {
+		badRequest(w, r, "Name must be between 1 and 50 characters")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		badRequest(w, r, "At least one scope is required")
+		return
+	}
+
+	client, err := h.authService.CreateServiceClient(r.Context(), req, claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to create client")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(client)
+}
+
+// ListServiceClients lists the service clients for an admin
+func (h *Handler) ListServiceClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.authService.ListServiceClients(r.Context())
+	if err != nil {
+		writeError(w, r, err, "Failed to list clients")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+// RevokeServiceClient revokes a service client and its tokens on behalf of an admin
+func (h *Handler) RevokeServiceClient(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	clientID := chi.URLParam(r, "id")
+
+	if err := h.authService.RevokeServiceClient(r.Context(), clientID, claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to revoke client")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
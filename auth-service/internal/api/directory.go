@@ -0,0 +1,89 @@
+// internal/api/directory.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+)
+
+const (
+	// Page size of user searches when the client does not ask for one, and the largest allowed
+	defaultUserSearchLimit = 20
+	maxUserSearchLimit     = 100
+
+	// Most users resolved by a single batch lookup
+	maxUserBatchSize = 100
+)
+
+// SearchUsers finds users whose username starts with the query or whose email is the query
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := strings.TrimSpace(params.Get("query"))
+	if query == "" {
+		badRequest(w, r, "Search query is required")
+		return
+	}
+
+	limit, offset := defaultUserSearchLimit, 0
+	var err error
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			badRequest(w, r, "Invalid limit")
+			return
+		}
+		if limit > maxUserSearchLimit {
+			limit = maxUserSearchLimit
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			badRequest(w, r, "Invalid offset")
+			return
+		}
+	}
+
+	users, err := h.authService.SearchUsers(r.Context(), query, limit, offset)
+	if err != nil {
+		writeError(w, r, err, "Failed to search users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":  users,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// LookupUsers resolves many user IDs to public profiles at once
+func (h *Handler) LookupUsers(w http.ResponseWriter, r *http.Request) {
+	var req models.UserBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+	if len(req.IDs) == 0 {
+		badRequest(w, r, "At least one user ID is required")
+		return
+	}
+	if len(req.IDs) > maxUserBatchSize {
+		badRequest(w, r, "Too many user IDs, at most "+strconv.Itoa(maxUserBatchSize)+" are allowed")
+		return
+	}
+
+	users, err := h.authService.LookupUsers(r.Context(), req.IDs)
+	if err != nil {
+		writeError(w, r, err, "Failed to look up users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+	})
+}
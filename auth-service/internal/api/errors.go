@@ -0,0 +1,100 @@
+// internal/api/errors.go
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/afzalabbasi/message-service/auth-service/internal/service"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// Error codes specific to the auth service; see apierror for the shared ones
+const (
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeEmailNotVerified     = "email_not_verified"
+	CodeInvalidEmailToken    = "invalid_email_token"
+	CodeInvalidRefreshToken  = "invalid_refresh_token"
+	CodeUserNotFound         = "user_not_found"
+	CodeUsernameTaken        = "username_taken"
+	CodeEmailTaken           = "email_taken"
+	CodeWrongPassword        = "wrong_password"
+	CodeAccountLocked        = "account_locked"
+	CodeInvalidRole          = "invalid_role"
+	CodeLastAdmin            = "last_admin"
+	CodeRoleNotFound         = "role_not_found"
+	CodeNotRoomManager       = "not_room_manager"
+	CodeCannotManageRole     = "cannot_manage_role"
+	CodeNotModerator         = "not_moderator"
+	CodeCannotModerate       = "cannot_moderate"
+	CodeSanctionNotFound     = "sanction_not_found"
+	CodeUnknownProvider      = "unknown_provider"
+	CodeSSOFailed            = "sso_failed"
+	CodeProviderUnavailable  = "provider_unavailable"
+	CodeSSOEmailRequired     = "sso_email_required"
+	CodeIdentityConflict     = "identity_conflict"
+	CodeInvalidChallenge     = "invalid_challenge"
+	CodeInvalidTwoFactorCode = "invalid_two_factor_code"
+	CodeTwoFactorNotEnrolled = "two_factor_not_enrolled"
+	CodeTwoFactorEnabled     = "two_factor_enabled"
+	CodeTwoFactorUnavailable = "two_factor_unavailable"
+	CodeInvalidScope         = "invalid_scope"
+	CodeClientNotFound       = "client_not_found"
+	CodeSessionNotFound      = "session_not_found"
+	CodeInvalidTicket        = "invalid_ticket"
+)
+
+// errorTable maps the service's errors to HTTP responses. Handlers check for errors that
+// need a different response in their context before falling back to it.
+var errorTable = apierror.Table{
+	{Err: service.ErrInvalidCredentials, Status: http.StatusUnauthorized, Code: CodeInvalidCredentials},
+	{Err: service.ErrEmailNotVerified, Status: http.StatusForbidden, Code: CodeEmailNotVerified, Message: "Email address has not been verified"},
+	{Err: service.ErrInvalidEmailToken, Status: http.StatusBadRequest, Code: CodeInvalidEmailToken},
+	{Err: service.ErrInvalidRefreshToken, Status: http.StatusUnauthorized, Code: CodeInvalidRefreshToken},
+	{Err: service.ErrUserNotFound, Status: http.StatusNotFound, Code: CodeUserNotFound, Message: "User not found"},
+	{Err: service.ErrUsernameTaken, Status: http.StatusConflict, Code: CodeUsernameTaken},
+	{Err: service.ErrEmailTaken, Status: http.StatusConflict, Code: CodeEmailTaken},
+	{Err: service.ErrWrongPassword, Status: http.StatusForbidden, Code: CodeWrongPassword},
+	{Err: service.ErrInvalidRole, Status: http.StatusBadRequest, Code: CodeInvalidRole},
+	{Err: service.ErrLastAdmin, Status: http.StatusConflict, Code: CodeLastAdmin},
+	{Err: service.ErrRoleNotFound, Status: http.StatusNotFound, Code: CodeRoleNotFound, Message: "Role not found"},
+	{Err: service.ErrNotRoomManager, Status: http.StatusForbidden, Code: CodeNotRoomManager},
+	{Err: service.ErrCannotManageRole, Status: http.StatusForbidden, Code: CodeCannotManageRole},
+	{Err: service.ErrNotModerator, Status: http.StatusForbidden, Code: CodeNotModerator},
+	{Err: service.ErrCannotModerate, Status: http.StatusForbidden, Code: CodeCannotModerate},
+	{Err: service.ErrSanctionNotFound, Status: http.StatusNotFound, Code: CodeSanctionNotFound},
+	{Err: service.ErrUnknownProvider, Status: http.StatusNotFound, Code: CodeUnknownProvider},
+	{Err: service.ErrInvalidSSOState, Status: http.StatusUnauthorized, Code: CodeSSOFailed, Message: "Failed to authenticate user"},
+	{Err: oidc.ErrInvalidIDToken, Status: http.StatusUnauthorized, Code: CodeSSOFailed, Message: "Failed to authenticate user"},
+	{Err: service.ErrSSOEmailRequired, Status: http.StatusConflict, Code: CodeSSOEmailRequired},
+	{Err: service.ErrIdentityConflict, Status: http.StatusConflict, Code: CodeIdentityConflict},
+	{Err: service.ErrInvalidChallenge, Status: http.StatusUnauthorized, Code: CodeInvalidChallenge},
+	{Err: service.ErrInvalidTwoFactorCode, Status: http.StatusForbidden, Code: CodeInvalidTwoFactorCode},
+	{Err: service.ErrTwoFactorNotEnrolled, Status: http.StatusConflict, Code: CodeTwoFactorNotEnrolled},
+	{Err: service.ErrTwoFactorEnabled, Status: http.StatusConflict, Code: CodeTwoFactorEnabled},
+	{Err: service.ErrTwoFactorUnavailable, Status: http.StatusNotImplemented, Code: CodeTwoFactorUnavailable},
+	{Err: service.ErrInvalidScope, Status: http.StatusBadRequest, Code: CodeInvalidScope, Message: "Unknown scope, expected one of " + strings.Join(auth.KnownScopes, ", ")},
+	{Err: service.ErrClientNotFound, Status: http.StatusNotFound, Code: CodeClientNotFound, Message: "Client not found"},
+	{Err: service.ErrSessionNotFound, Status: http.StatusNotFound, Code: CodeSessionNotFound, Message: "Session not found"},
+	{Err: service.ErrInvalidTicket, Status: http.StatusUnauthorized, Code: CodeInvalidTicket},
+}
+
+// writeError responds with the invalid fields if err is a validation error, and otherwise
+// with the mapping of err, or a 500 with the fallback message
+func writeError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		apierror.WriteFields(w, r, fields)
+		return
+	}
+	errorTable.WriteError(w, r, err, fallback)
+}
+
+// badRequest responds with 400 and the shared invalid_request code
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, message)
+}
@@ -3,23 +3,38 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	authmw "github.com/afzalabbasi/message-service/auth-service/internal/middleware"
 	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/ratelimit"
 	"github.com/afzalabbasi/message-service/auth-service/internal/service"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/realip"
 	"github.com/go-chi/chi/v5"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 // Handler handles HTTP requests for the auth service
 type Handler struct {
-	authService *service.AuthService
+	authService   *service.AuthService
+	jwtMiddleware *authmw.JWTMiddleware
+
+	// Proxies whose forwarding headers name the client; see realip.Middleware
+	trustedProxies []*net.IPNet
 }
 
 // NewHandler creates a new Handler
-func NewHandler(authService *service.AuthService) *Handler {
+func NewHandler(authService *service.AuthService, jwtMiddleware *authmw.JWTMiddleware, trustedProxies []*net.IPNet) *Handler {
 	return &Handler{
-		authService: authService,
+		authService:    authService,
+		jwtMiddleware:  jwtMiddleware,
+		trustedProxies: trustedProxies,
 	}
 }
 
@@ -31,39 +46,129 @@ func (h *Handler) SetupRoutes() http.Handler {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realip.Middleware(h.trustedProxies))
+	r.NotFound(apierror.NotFound)
+	r.MethodNotAllowed(apierror.MethodNotAllowed)
 
 	// Routes
 	r.Post("/register", h.Register)
 	r.Post("/login", h.Login)
+	r.Post("/login/2fa", h.LoginTwoFactor)
+	r.Get("/oidc/providers", h.SSOProviders)
+	r.Get("/oidc/{provider}/login", h.SSOLogin)
+	r.Post("/oidc/{provider}/callback", h.SSOCallback)
+	r.Post("/token/refresh", h.Refresh)
+	r.Post("/oauth/token", h.Token)
+	r.Post("/email/verify", h.VerifyEmail)
+	r.Post("/email/verify/resend", h.ResendVerification)
+	r.Post("/password/forgot", h.ForgotPassword)
+	r.Post("/password/reset", h.ResetPassword)
+	r.Get("/.well-known/jwks.json", h.JWKS)
 	r.Get("/health", h.HealthCheck)
 
-	// Protected routes can be added here with JWT middleware
+	// Routes for other services, which authenticate as service clients: the lists they load
+	// at startup and connection ticket redemption
+	r.Group(func(r chi.Router) {
+		r.Use(h.jwtMiddleware.Authenticate)
+		r.Use(requireServiceClient(auth.ScopeRoomsAdmin))
+		r.Get("/revocations", h.Revocations)
+		r.Get("/sanctions", h.Sanctions)
+		r.Post("/ws-tickets/redeem", h.RedeemConnectionTicket)
+	})
+
+	// Protected routes
+	r.Group(func(r chi.Router) {
+		r.Use(h.jwtMiddleware.Authenticate)
+		r.Post("/logout", h.Logout)
+		r.Get("/me", h.GetMe)
+		r.Patch("/me", h.UpdateMe)
+		r.Post("/me/password", h.ChangePassword)
+		r.Get("/me/sessions", h.ListSessions)
+		r.Post("/me/room-roles", h.GetMyRoomRoles)
+		r.Post("/ws-tickets", h.IssueConnectionTicket)
+		r.Delete("/me/sessions/{id}", h.RevokeSession)
+		r.Post("/me/2fa", h.EnrollTwoFactor)
+		r.Post("/me/2fa/confirm", h.ConfirmTwoFactor)
+		r.Delete("/me/2fa", h.DisableTwoFactor)
+		r.Post("/me/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+		r.Delete("/users/me", h.DeleteMe)
+		r.Get("/users", h.SearchUsers)
+		r.Post("/users/batch", h.LookupUsers)
+		r.Get("/users/{id}", h.GetUser)
+		r.Get("/rooms/{roomID}/roles/me", h.GetMyRoomRole)
+		r.Get("/rooms/{roomID}/roles", h.RoomRoles)
+		r.Put("/rooms/{roomID}/roles/{userID}", h.GrantRoomRole)
+		r.Delete("/rooms/{roomID}/roles/{userID}", h.RevokeRoomRole)
+		r.Get("/rooms/{roomID}/moderation", h.RoomSanctions)
+		r.Post("/rooms/{roomID}/moderation/{kind}", h.Sanction)
+		r.Delete("/rooms/{roomID}/moderation/{kind}/{userID}", h.LiftSanction)
+
+		// Admin routes
+		r.Group(func(r chi.Router) {
+			r.Use(h.requireAdmin)
+			r.Delete("/users/{id}", h.DeleteUser)
+			r.Post("/admin/tokens/revoke", h.RevokeToken)
+			r.Post("/admin/users/{id}/revoke-tokens", h.RevokeUserTokens)
+			r.Get("/admin/clients", h.ListServiceClients)
+			r.Post("/admin/clients", h.CreateServiceClient)
+			r.Delete("/admin/clients/{id}", h.RevokeServiceClient)
+			r.Put("/admin/users/{id}/role", h.SetUserRole)
+			r.Get("/admin/rooms/{roomID}/roles", h.ListRoomRoles)
+			r.Put("/admin/rooms/{roomID}/roles/{userID}", h.SetRoomRole)
+			r.Delete("/admin/rooms/{roomID}/roles/{userID}", h.RemoveRoomRole)
+		})
+	})
 
 	return r
 }
 
+// requireAdmin middleware rejects callers that are not admins
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.FromContext(r.Context())
+		if !ok || claims.Bot {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Admin access required")
+			return
+		}
+		admin, err := h.authService.IsAdmin(r.Context(), claims.UserID)
+		if err != nil {
+			writeError(w, r, err, "Failed to check permissions")
+			return
+		}
+		if !admin {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireServiceClient returns middleware rejecting callers other than service clients
+// granted scope; user tokens do not qualify, whatever the user's role
+func requireServiceClient(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.FromContext(r.Context())
+			if !ok || !claims.Bot || !claims.HasScope(scope) {
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Service client access required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Register handles user registration
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		badRequest(w, r, "Invalid request payload")
 		return
 	}
 
-	// Validate request
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		http.Error(w, "Username, email, and password are required", http.StatusBadRequest)
-		return
-	}
-
-	resp, err := h.authService.Register(r.Context(), req)
+	resp, err := h.authService.Register(r.Context(), req, clientInfo(r))
 	if err != nil {
-		if err.Error() == "user already exists" {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		writeError(w, r, err, "Failed to register user")
 		return
 	}
 
@@ -76,23 +181,250 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		badRequest(w, r, "Invalid request payload")
 		return
 	}
 
 	// Validate request
 	if (req.Username == "" && req.Email == "") || req.Password == "" {
-		http.Error(w, "Username or email, and password are required", http.StatusBadRequest)
+		badRequest(w, r, "Username or email, and password are required")
 		return
 	}
 
-	resp, err := h.authService.Login(r.Context(), req)
+	resp, err := h.authService.Login(r.Context(), req, clientInfo(r))
 	if err != nil {
-		if err.Error() == "invalid credentials" {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		if writeLimitError(w, r, err) {
 			return
 		}
-		http.Error(w, "Failed to authenticate user", http.StatusInternalServerError)
+		writeError(w, r, err, "Failed to authenticate user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// VerifyEmail confirms an email address using the token from a verification email
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if err := h.authService.VerifyEmail(r.Context(), req.Token); err != nil {
+		writeError(w, r, err, "Failed to verify email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification sends a new verification email. It accepts every address so it does
+// not reveal which ones are registered.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if err := h.authService.ResendVerification(r.Context(), req.Email); err != nil {
+		writeError(w, r, err, "Failed to send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword sends a password reset email. It accepts every address so it does not
+// reveal which ones are registered.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if err := h.authService.ForgotPassword(r.Context(), req.Email); err != nil {
+		writeError(w, r, err, "Failed to send password reset email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using the token from a password reset email
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.Token == "" {
+		badRequest(w, r, "Token is required")
+		return
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), req, clientInfo(r)); err != nil {
+		writeError(w, r, err, "Failed to reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLimitError responds with 429 if err is a login throttling error and reports whether it did
+func writeLimitError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var limitErr *ratelimit.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.RetryAfter.Seconds())+1))
+	if limitErr.Locked {
+		apierror.Write(w, r, http.StatusTooManyRequests, CodeAccountLocked, "Account temporarily locked due to failed login attempts")
+	} else {
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many login attempts")
+	}
+	return true
+}
+
+// clientIP returns the client's IP address; realip.Middleware has already applied the
+// headers of trusted proxies
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// clientInfo describes the client making a request that starts or refreshes a session.
+// Clients may name the device in the X-Device-Name header for the session list.
+func clientInfo(r *http.Request) models.ClientInfo {
+	return models.ClientInfo{
+		DeviceName: r.Header.Get("X-Device-Name"),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  clientIP(r),
+	}
+}
+
+// Logout revokes the caller's access token and optionally their refresh token
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	// The body is optional
+	var req models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			badRequest(w, r, "Invalid request payload")
+			return
+		}
+	}
+
+	if err := h.authService.Logout(r.Context(), claims, req.RefreshToken); err != nil {
+		writeError(w, r, err, "Failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeToken revokes a single access token on behalf of an admin
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.RevokeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.TokenID == "" || req.UserID == "" {
+		badRequest(w, r, "Token ID and user ID are required")
+		return
+	}
+
+	// The token's own expiry is unknown here, but it cannot outlive the configured lifetime
+	expiresAt := time.Now().Add(h.authService.AccessTokenLifetime())
+	if err := h.authService.RevokeToken(r.Context(), req.TokenID, req.UserID, expiresAt, claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to revoke token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserTokens revokes all of a user's tokens on behalf of an admin
+func (h *Handler) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	userID := chi.URLParam(r, "id")
+
+	if err := h.authService.RevokeUserTokens(r.Context(), userID, claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to revoke tokens")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys that verify access tokens
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.jwtMiddleware.Keys.JWKS())
+}
+
+// Revocations lists revoked tokens that have not expired yet, for other services to enforce
+func (h *Handler) Revocations(w http.ResponseWriter, r *http.Request) {
+	revocations, err := h.authService.ActiveRevocations(r.Context())
+	if err != nil {
+		writeError(w, r, err, "Failed to list revocations")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revocations)
+}
+
+// DeleteMe deletes the authenticated user's account
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	h.deleteUser(w, r, claims.UserID, claims.UserID)
+}
+
+// DeleteUser deletes any user's account on behalf of an admin
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	h.deleteUser(w, r, chi.URLParam(r, "id"), claims.UserID)
+}
+
+// deleteUser deletes a user and reports the outcome
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request, userID, requestedBy string) {
+	if err := h.authService.DeleteUser(r.Context(), userID, requestedBy); err != nil {
+		writeError(w, r, err, "Failed to delete user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		badRequest(w, r, "Refresh token is required")
+		return
+	}
+
+	resp, err := h.authService.Refresh(r.Context(), req.RefreshToken, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err, "Failed to refresh token")
 		return
 	}
 
@@ -0,0 +1,108 @@
+// internal/api/moderation.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// Sanction kicks, bans or mutes a user in a room
+func (h *Handler) Sanction(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+	kind := chi.URLParam(r, "kind")
+
+	if kind != models.SanctionKick && kind != models.SanctionBan && kind != models.SanctionMute {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Unknown moderation action")
+		return
+	}
+
+	var req models.SanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.UserID == "" {
+		badRequest(w, r, "User ID is required")
+		return
+	}
+	if len(req.Reason) > 500 {
+		badRequest(w, r, "Reason must be at most 500 characters")
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" && kind != models.SanctionKick {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			badRequest(w, r, "Invalid duration")
+			return
+		}
+	}
+	if kind == models.SanctionMute && duration == 0 {
+		badRequest(w, r, "Mutes require a duration")
+		return
+	}
+
+	sanction, err := h.authService.Sanction(r.Context(), claims, roomID, kind, req, duration)
+	if err != nil {
+		writeError(w, r, err, "Failed to moderate room")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sanction)
+}
+
+// LiftSanction ends a ban or mute
+func (h *Handler) LiftSanction(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	kind := chi.URLParam(r, "kind")
+
+	if kind != models.SanctionBan && kind != models.SanctionMute {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "Unknown moderation action")
+		return
+	}
+
+	if err := h.authService.LiftSanction(r.Context(), claims, chi.URLParam(r, "roomID"), chi.URLParam(r, "userID"), kind); err != nil {
+		writeError(w, r, err, "Failed to moderate room")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RoomSanctions lists the bans and mutes in effect in a room
+func (h *Handler) RoomSanctions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	sanctions, err := h.authService.RoomSanctions(r.Context(), claims, chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, r, err, "Failed to moderate room")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sanctions)
+}
+
+// Sanctions lists every ban and mute in effect, for other services to enforce
+func (h *Handler) Sanctions(w http.ResponseWriter, r *http.Request) {
+	sanctions, err := h.authService.ActiveSanctions(r.Context())
+	if err != nil {
+		writeError(w, r, err, "Failed to list sanctions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sanctions)
+}
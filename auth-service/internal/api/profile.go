@@ -0,0 +1,87 @@
+// internal/api/profile.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetMe returns the caller's account
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	user, err := h.authService.GetUser(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to get user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateMe changes the caller's username, email or profile
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(r.Context(), claims.UserID, req)
+	if err != nil {
+		writeError(w, r, err, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ChangePassword replaces the caller's password. Every existing token is revoked and the
+// response carries new tokens in a new session.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.CurrentPassword == "" {
+		apierror.WriteFields(w, r, []apierror.FieldError{{Field: "current_password", Code: validation.CodeRequired, Message: "Current password is required"}})
+		return
+	}
+
+	resp, err := h.authService.ChangePassword(r.Context(), claims.UserID, req, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err, "Failed to change password")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetUser returns a user's public profile
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	profile, err := h.authService.GetProfile(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err, "Failed to get user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
@@ -0,0 +1,165 @@
+// internal/api/roles.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetMyRoomRole returns the caller's role in a room; other services use it to authorize
+// requests in the caller's name
+func (h *Handler) GetMyRoomRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	access, err := h.authService.RoomAccess(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to get role")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(access)
+}
+
+// GetMyRoomRoles returns the caller's roles in several rooms at once, so other services
+// can filter many rooms without a request per room
+func (h *Handler) GetMyRoomRoles(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.RoomBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+	if len(req.RoomIDs) > authz.MaxAccessBatch {
+		badRequest(w, r, "Too many room IDs, at most "+strconv.Itoa(authz.MaxAccessBatch)+" are allowed")
+		return
+	}
+
+	rooms, err := h.authService.RoomAccesses(r.Context(), req.RoomIDs, claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to get roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rooms": rooms,
+	})
+}
+
+// SetUserRole changes a user's global role on behalf of an admin
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	userID := chi.URLParam(r, "id")
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if err := h.authService.SetUserRole(r.Context(), userID, req.Role, claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRoomRoles lists the role assignments of a room for an admin
+func (h *Handler) ListRoomRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.authService.ListRoomRoles(r.Context(), chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// SetRoomRole grants a role in a room on behalf of an admin
+func (h *Handler) SetRoomRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	role, err := h.authService.SetRoomRole(r.Context(), chi.URLParam(r, "roomID"), chi.URLParam(r, "userID"), req.Role, claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(role)
+}
+
+// RemoveRoomRole revokes a role in a room on behalf of an admin
+func (h *Handler) RemoveRoomRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	if err := h.authService.RemoveRoomRole(r.Context(), chi.URLParam(r, "roomID"), chi.URLParam(r, "userID"), claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RoomRoles lists the role assignments of a room for a caller allowed to manage them
+func (h *Handler) RoomRoles(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	roles, err := h.authService.ManagedRoomRoles(r.Context(), claims, chi.URLParam(r, "roomID"))
+	if err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// GrantRoomRole grants a role in a room on behalf of one of its owners
+func (h *Handler) GrantRoomRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	role, err := h.authService.GrantRoomRole(r.Context(), claims, chi.URLParam(r, "roomID"), chi.URLParam(r, "userID"), req.Role)
+	if err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(role)
+}
+
+// RevokeRoomRole revokes a role in a room on behalf of one of its owners
+func (h *Handler) RevokeRoomRole(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	if err := h.authService.RevokeRoomRole(r.Context(), claims, chi.URLParam(r, "roomID"), chi.URLParam(r, "userID")); err != nil {
+		writeError(w, r, err, "Failed to manage roles")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
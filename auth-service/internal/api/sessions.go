@@ -0,0 +1,36 @@
+// internal/api/sessions.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+// ListSessions lists the devices the caller is logged in on
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	sessions, err := h.authService.ListSessions(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		writeError(w, r, err, "Failed to list sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession logs the caller out of one of their sessions, which may be the current one
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	if err := h.authService.RevokeSession(r.Context(), claims.UserID, chi.URLParam(r, "id"), claims.UserID); err != nil {
+		writeError(w, r, err, "Failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+// internal/api/sso.go
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/afzalabbasi/message-service/auth-service/internal/service"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/go-chi/chi/v5"
+)
+
+// SSOProviders lists the identity providers for the login page
+func (h *Handler) SSOProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SSOProviders{Providers: h.authService.SSOProviders()})
+}
+
+// ssoBindingCookie ties a single sign-on login to the browser that started it
+const ssoBindingCookie = "sso_binding"
+
+// SSOLogin redirects the browser to the identity provider's login page
+func (h *Handler) SSOLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authURL, binding, err := h.authService.StartSSOLogin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProvider) {
+			writeError(w, r, err, "")
+			return
+		}
+		log.Printf("Error starting %s login: %v", provider, err)
+		apierror.Write(w, r, http.StatusBadGateway, CodeProviderUnavailable, "Identity provider unavailable")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoBindingCookie,
+		Value:    binding,
+		Path:     "/oidc/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// SSOCallback completes a login with the code the identity provider sent to the web app.
+// The web app must send it with the browser's cookies, which carry the login's binding.
+func (h *Handler) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	var req models.SSOCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.Code == "" || req.State == "" {
+		badRequest(w, r, "Code and state are required")
+		return
+	}
+
+	var binding string
+	if cookie, err := r.Cookie(ssoBindingCookie); err == nil {
+		binding = cookie.Value
+	}
+	// The binding is only good for one login
+	http.SetCookie(w, &http.Cookie{Name: ssoBindingCookie, Path: "/oidc/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+
+	resp, err := h.authService.CompleteSSOLogin(r.Context(), provider, req, binding, clientInfo(r))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSSOState) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			log.Printf("Rejected %s login: %v", provider, err)
+		}
+		if _, ok := errorTable.Lookup(err); ok {
+			writeError(w, r, err, "Failed to authenticate user")
+			return
+		}
+		// Includes codes the provider refused to redeem
+		log.Printf("Error completing %s login: %v", provider, err)
+		apierror.Write(w, r, http.StatusBadGateway, CodeProviderUnavailable, "Failed to authenticate user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
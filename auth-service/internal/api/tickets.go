@@ -0,0 +1,45 @@
+// internal/api/tickets.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// IssueConnectionTicket issues the caller a single-use ticket for opening a WebSocket
+// connection without putting their access token in the URL
+func (h *Handler) IssueConnectionTicket(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	ticket, err := h.authService.IssueConnectionTicket(r.Context(), claims)
+	if err != nil {
+		writeError(w, r, err, "Failed to issue ticket")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// RedeemConnectionTicket uses up a connection ticket on behalf of the WebSocket service and
+// returns who it was issued to and their access to the room
+func (h *Handler) RedeemConnectionTicket(w http.ResponseWriter, r *http.Request) {
+	var req models.RedeemTicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ticket == "" || req.RoomID == "" {
+		badRequest(w, r, "Ticket and room ID are required")
+		return
+	}
+
+	redeemed, err := h.authService.RedeemConnectionTicket(r.Context(), req.Ticket, req.RoomID)
+	if err != nil {
+		writeError(w, r, err, "Failed to redeem ticket")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redeemed)
+}
@@ -0,0 +1,125 @@
+// internal/api/twofactor.go
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/service"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// LoginTwoFactor completes a login of a user with two-factor authentication
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		badRequest(w, r, "Challenge token and code or recovery code are required")
+		return
+	}
+
+	resp, err := h.authService.CompleteTwoFactorLogin(r.Context(), req, clientInfo(r))
+	if err != nil {
+		if writeLimitError(w, r, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			// A wrong code fails the login, it does not forbid an action of a logged in user
+			apierror.Write(w, r, http.StatusUnauthorized, CodeInvalidTwoFactorCode, err.Error())
+		case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+			// Two-factor authentication was disabled after the challenge was issued
+			writeError(w, r, service.ErrInvalidChallenge, "Failed to authenticate user")
+		default:
+			writeError(w, r, err, "Failed to authenticate user")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EnrollTwoFactor starts two-factor enrollment and returns the secret for the authenticator app
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	enrollment, err := h.authService.EnrollTwoFactor(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, err, "Failed to update two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a first code from the app
+func (h *Handler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		badRequest(w, r, "Code is required")
+		return
+	}
+
+	codes, err := h.authService.ConfirmTwoFactor(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeError(w, r, err, "Failed to update two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodes{Codes: codes})
+}
+
+// DisableTwoFactor turns off two-factor authentication
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "Invalid request payload")
+		return
+	}
+
+	if req.Password == "" || (req.Code == "" && req.RecoveryCode == "") {
+		badRequest(w, r, "Password and code or recovery code are required")
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(r.Context(), claims.UserID, req); err != nil {
+		writeError(w, r, err, "Failed to update two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		badRequest(w, r, "Code is required")
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeError(w, r, err, "Failed to update two-factor authentication")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodes{Codes: codes})
+}
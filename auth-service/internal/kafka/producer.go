@@ -0,0 +1,94 @@
+// internal/kafka/producer.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/segmentio/kafka-go"
+	"log"
+)
+
+// Producer represents a Kafka producer
+type Producer struct {
+	writer *kafka.Writer
+
+	// Writes to the audit events topic
+	audit *kafka.Writer
+}
+
+// NewProducer creates a new Kafka producer for user and audit events
+func NewProducer(cfg *config.Config) (*Producer, error) {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.KafkaBrokers...),
+		Topic:        cfg.KafkaUserEventsTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        false,
+	}
+
+	audit := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.KafkaBrokers...),
+		Topic:        cfg.KafkaAuditTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        false,
+	}
+
+	return &Producer{
+		writer: writer,
+		audit:  audit,
+	}, nil
+}
+
+// PublishUserEvent publishes a user event to Kafka, keyed by user so a user's events stay ordered
+func (p *Producer) PublishUserEvent(ctx context.Context, event models.UserEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = p.writer.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(event.UserID),
+			Value: value,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to write user event to Kafka: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// PublishAuditEvent publishes an audit event to Kafka, keyed by actor
+func (p *Producer) PublishAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = p.audit.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(event.ActorID),
+			Value: value,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to write audit event to Kafka: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the Kafka producer
+func (p *Producer) Close() error {
+	if err := p.audit.Close(); err != nil {
+		p.writer.Close()
+		return err
+	}
+	return p.writer.Close()
+}
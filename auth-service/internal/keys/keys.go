@@ -0,0 +1,267 @@
+// internal/keys/keys.go
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Key is a private key used to sign access tokens
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Manager holds the signing keys of the auth service.
+//
+// Keys are PEM encoded private keys (PKCS#8, or PKCS#1 for RSA) stored as <kid>.pem in a
+// directory, e.g. a mounted Kubernetes secret. Every key in the directory is published in
+// the JWKS and accepted for verification; one of them signs new tokens. To rotate, add the
+// new key, wait until verifiers have refreshed their JWKS, make it the signing key, and
+// remove the old key once the last token it signed has expired.
+type Manager struct {
+	dir          string
+	signingKeyID string
+
+	mu      sync.RWMutex
+	keys    map[string]*Key
+	signing *Key
+}
+
+// NewManager loads the keys in dir. The key named signingKeyID signs new tokens; if it is
+// empty, the key with the greatest ID does. Without a directory an ephemeral key is
+// generated, which only works for a single replica and is meant for development.
+func NewManager(dir, signingKeyID string) (*Manager, error) {
+	m := &Manager{
+		dir:          dir,
+		signingKeyID: signingKeyID,
+	}
+
+	if dir == "" {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key := &Key{
+			ID:      "ephemeral-" + time.Now().UTC().Format("20060102T150405"),
+			Method:  jwt.SigningMethodEdDSA,
+			Private: private,
+		}
+		log.Printf("No signing keys configured, using ephemeral key %s", key.ID)
+		m.keys = map[string]*Key{key.ID: key}
+		m.signing = key
+		return m, nil
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload re-reads the key directory. The current keys stay in use if it fails.
+func (m *Manager) Reload() error {
+	if m.dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key)
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(m.dir, name))
+		if err != nil {
+			return err
+		}
+		id := strings.TrimSuffix(name, ".pem")
+		key, err := parseKey(id, data)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", id, err)
+		}
+		keys[id] = key
+		ids = append(ids, id)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys found in %s", m.dir)
+	}
+
+	signingKeyID := m.signingKeyID
+	if signingKeyID == "" {
+		sort.Strings(ids)
+		signingKeyID = ids[len(ids)-1]
+	}
+	signing, ok := keys[signingKeyID]
+	if !ok {
+		return fmt.Errorf("signing key %s not found in %s", signingKeyID, m.dir)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.signing == nil || m.signing.ID != signing.ID {
+		log.Printf("Signing tokens with key %s", signing.ID)
+	}
+	m.keys = keys
+	m.signing = signing
+	return nil
+}
+
+// Watch reloads the keys every interval until ctx is done, so keys can be rotated
+// without a restart
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	if m.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reload(); err != nil {
+				log.Printf("Error reloading signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// SigningKey returns the key that signs new tokens
+func (m *Manager) SigningKey() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.signing
+}
+
+// Key returns the key with the given ID
+func (m *Manager) Key(id string) (*Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.keys[id]
+	return key, ok
+}
+
+// Keyfunc returns the public key that verifies a token, selected by its kid header
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := m.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Private.Public(), nil
+}
+
+// JWKS returns the public halves of all keys
+func (m *Manager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		jwk := JWK{
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+		switch public := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// parseKey parses a PEM encoded RSA or Ed25519 private key
+func parseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, Private: private}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, Private: private}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+}
@@ -0,0 +1,44 @@
+// internal/mail/log.go
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes emails to a file, or to the log if no file is set, instead of sending
+// them. It is meant for local development.
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{path: path}
+}
+
+// Send records an email
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.path == "" {
+		log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -2,93 +2,97 @@
 package middleware
 
 import (
-	"context"
-	"errors"
-	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"net/http"
-	"strings"
 	"time"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/keys"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-// Claims defines the JWT claims structure
-type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	jwt.RegisteredClaims
-}
+// ChallengeAudience is the aud claim of two-factor challenge tokens. It keeps them from
+// being accepted as access tokens.
+const ChallengeAudience = "auth-service/2fa"
 
-// JWTMiddleware holds the configuration for JWT authentication
+// JWTMiddleware issues access tokens and authenticates requests that carry them
 type JWTMiddleware struct {
-	Secret string
+	Keys     *keys.Manager
+	Verifier *auth.Verifier
+
+	// Verifies the challenge tokens issued between the two steps of a two-factor login
+	ChallengeVerifier *auth.Verifier
+
+	// iss and aud claims of issued tokens
+	Issuer   string
+	Audience string
 }
 
 // NewJWTMiddleware creates a new JWT middleware
-func NewJWTMiddleware(secret string) *JWTMiddleware {
+func NewJWTMiddleware(keyManager *keys.Manager, issuer, audience string, leeway time.Duration) *JWTMiddleware {
 	return &JWTMiddleware{
-		Secret: secret,
+		Keys: keyManager,
+		Verifier: auth.NewVerifier(auth.VerifierConfig{
+			Keys:     keyManager.Keyfunc,
+			Issuer:   issuer,
+			Audience: audience,
+			Leeway:   leeway,
+		}),
+		ChallengeVerifier: auth.NewVerifier(auth.VerifierConfig{
+			Keys:     keyManager.Keyfunc,
+			Issuer:   issuer,
+			Audience: ChallengeAudience,
+			Leeway:   leeway,
+		}),
+		Issuer:   issuer,
+		Audience: audience,
 	}
 }
 
-// GenerateToken generates a new JWT token for a user
-func (m *JWTMiddleware) GenerateToken(userID, username string, expiration time.Duration) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	}
+// GenerateToken generates a new JWT token for a user's login session with the given global roles
+func (m *JWTMiddleware) GenerateToken(userID, username, sessionID string, roles []string, expiration time.Duration) (string, error) {
+	return m.sign(&auth.Claims{UserID: userID, Username: username, Roles: roles, SessionID: sessionID}, m.Audience, expiration)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.Secret))
+// GenerateMachineToken generates a token for a service client, limited to scopes
+func (m *JWTMiddleware) GenerateMachineToken(clientID, name string, scopes []string, expiration time.Duration) (string, error) {
+	return m.sign(&auth.Claims{UserID: clientID, Username: name, Bot: true, Scopes: scopes}, m.Audience, expiration)
 }
 
-// ValidateToken validates a JWT token
-func (m *JWTMiddleware) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(m.Secret), nil
-	})
+// GenerateChallengeToken generates a token proving that a user passed the password step
+// of a two-factor login
+func (m *JWTMiddleware) GenerateChallengeToken(userID, username string, expiration time.Duration) (string, error) {
+	return m.sign(&auth.Claims{UserID: userID, Username: username}, ChallengeAudience, expiration)
+}
 
-	if err != nil {
-		return nil, err
-	}
+// ValidateChallengeToken validates a token from GenerateChallengeToken
+func (m *JWTMiddleware) ValidateChallengeToken(tokenString string) (*auth.Claims, error) {
+	return m.ChallengeVerifier.Verify(tokenString)
+}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+// sign completes claims with the registered claims and signs them with the current signing key
+func (m *JWTMiddleware) sign(claims *auth.Claims, audience string, expiration time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    m.Issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
 	}
 
-	return nil, errors.New("invalid token")
+	key := m.Keys.SigningKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// ValidateToken validates a JWT token
+func (m *JWTMiddleware) ValidateToken(tokenString string) (*auth.Claims, error) {
+	return m.Verifier.Verify(tokenString)
 }
 
 // Authenticate middleware for authenticating requests
 func (m *JWTMiddleware) Authenticate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			http.Error(w, "Authorization header must be in the format 'Bearer {token}'", http.StatusUnauthorized)
-			return
-		}
-
-		claims, err := m.ValidateToken(tokenParts[1])
-		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-
-		// Add claims to request context
-		ctx := context.WithValue(r.Context(), "user", claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return m.Verifier.Middleware(next)
 }
@@ -0,0 +1,41 @@
+// internal/models/audit.go
+package models
+
+import (
+	"time"
+)
+
+// AuditService names the auth service as the source of its audit events
+const AuditService = "auth-service"
+
+// Audit actions published by the auth service. Moderation actions use the names of the
+// room moderation events.
+const (
+	AuditUserRegistered    = "user_registered"
+	AuditLoginSucceeded    = "login_succeeded"
+	AuditLoginFailed       = "login_failed"
+	AuditAccountLocked     = "account_locked"
+	AuditPasswordChanged   = "password_changed"
+	AuditPasswordReset     = "password_reset"
+	AuditTwoFactorEnabled  = "two_factor_enabled"
+	AuditTwoFactorDisabled = "two_factor_disabled"
+	AuditSessionRevoked    = "session_revoked"
+	AuditRoleChanged       = "role_changed"
+	AuditRoomRoleGranted   = "room_role_granted"
+	AuditRoomRoleRevoked   = "room_role_revoked"
+)
+
+// AuditEvent records a security-relevant action for the audit log
+type AuditEvent struct {
+	EventID   string    `json:"event_id"`
+	Service   string    `json:"service"`
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actor_id,omitempty"`  // user or client that acted; empty if not authenticated
+	TargetID  string    `json:"target_id,omitempty"` // user the action was taken on, if not the actor
+	RoomID    string    `json:"room_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Action-specific details, e.g. the login method or the reason of a failure
+	Details map[string]string `json:"details,omitempty"`
+}
@@ -0,0 +1,50 @@
+// internal/models/event.go
+package models
+
+import (
+	"time"
+)
+
+// User event types published to the user events topic
+const (
+	EventUserDeleted       = "user_deleted"
+	EventTokenRevoked      = "token_revoked"
+	EventUserTokensRevoked = "user_tokens_revoked"
+	EventSessionRevoked    = "session_revoked"
+	EventUsernameChanged   = "username_changed"
+	EventAccountLocked     = "account_locked"
+
+	// Room moderation; RoomID names the room and ExpiresAt, if set, when a ban or mute ends
+	EventRoomUserKicked   = "room_user_kicked"
+	EventRoomUserBanned   = "room_user_banned"
+	EventRoomUserUnbanned = "room_user_unbanned"
+	EventRoomUserMuted    = "room_user_muted"
+	EventRoomUserUnmuted  = "room_user_unmuted"
+)
+
+// UserEvent is published to Kafka when something happens to a user account
+type UserEvent struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"` // e.g., "user_deleted"
+	UserID    string    `json:"user_id"`
+	ActorID   string    `json:"actor_id,omitempty"` // user who triggered the event, if not UserID
+	Timestamp time.Time `json:"timestamp"`          // for user_tokens_revoked, tokens issued before this are revoked
+
+	// Set on token_revoked events; on account_locked events ExpiresAt is when the lock ends,
+	// on session_revoked events when the last token issued to the session expires
+	TokenID   string     `json:"token_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Set on session_revoked events
+	SessionID string `json:"session_id,omitempty"`
+
+	// Set on account_locked events to the client that caused the lockout
+	IPAddress string `json:"ip_address,omitempty"`
+
+	// Set on username_changed events to the new username
+	Username string `json:"username,omitempty"`
+
+	// Set on room moderation events
+	RoomID string `json:"room_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
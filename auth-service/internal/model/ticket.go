@@ -0,0 +1,27 @@
+// internal/models/ticket.go
+package models
+
+import (
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+)
+
+// ConnectionTicket is a single-use ticket that opens a WebSocket connection in place of the
+// access token, which then stays out of URLs and the logs that record them
+type ConnectionTicket struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int64  `json:"expires_in"` // ticket lifetime in seconds
+}
+
+// RedeemTicketRequest uses up a connection ticket to join a room
+type RedeemTicketRequest struct {
+	Ticket string `json:"ticket"`
+	RoomID string `json:"room_id"`
+}
+
+// RedeemedTicket carries the claims of the token a ticket was issued for and the caller's
+// access to the room being joined
+type RedeemedTicket struct {
+	Claims *auth.Claims      `json:"claims"`
+	Access *authz.RoomAccess `json:"access"`
+}
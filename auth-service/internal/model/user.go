@@ -3,8 +3,6 @@ package models
 
 import (
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents a user in the system
@@ -15,6 +13,38 @@ type User struct {
 	Password  string    `json:"-" db:"passwor"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	DisplayName     string     `json:"display_name,omitempty" db:"display_name"`
+	AvatarURL       string     `json:"avatar_url,omitempty" db:"avatar_url"`
+}
+
+// Profile is the public view of a user
+type Profile struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserBatchRequest lists the users to resolve at once
+type UserBatchRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// UpdateProfileRequest changes the fields of the caller's account that are set
+type UpdateProfileRequest struct {
+	Username    *string `json:"username"`
+	Email       *string `json:"email"`
+	DisplayName *string `json:"display_name"` // empty to clear
+	AvatarURL   *string `json:"avatar_url"`   // empty to clear
+}
+
+// ChangePasswordRequest replaces the caller's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // AuthRequest represents a login or registration request
@@ -26,22 +56,195 @@ type AuthRequest struct {
 
 // AuthResponse represents a successful authentication response
 type AuthResponse struct {
+	Token        string `json:"token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"` // access token lifetime in seconds
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Username     string `json:"username"`
+	UserID       string `json:"user_id"`
+	SessionID    string `json:"session_id,omitempty"`
+
+	// Set instead of the tokens when the user has to verify their email before logging in
+	EmailVerificationRequired bool `json:"email_verification_required,omitempty"`
+
+	// Set instead of the tokens when the login has to be completed with a second factor
+	// at POST /login/2fa
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for new tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenRequest carries a token from an emailed link
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// EmailRequest identifies an account by its email address
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password using a token from a password reset email
+type ResetPasswordRequest struct {
 	Token    string `json:"token"`
-	Username string `json:"username"`
-	UserID   string `json:"user_id"`
+	Password string `json:"password"`
+}
+
+// TwoFactorEnrollment is a new, not yet confirmed TOTP secret
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to show as a QR code
+}
+
+// TwoFactorCodeRequest carries a code from the user's authenticator app
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes are single-use codes that stand in for the authenticator app
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// DisableTwoFactorRequest turns off two-factor authentication; the password and either a
+// code or a recovery code are required
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorLoginRequest completes a login with the challenge token returned by Login and
+// either a code or a recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
 }
 
-// HashPassword creates a hashed password from a plaintext password
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedBytes), nil
+// LogoutRequest optionally carries the refresh token to revoke along with the access token
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
-// CheckPassword validates a plaintext password against a hashed password
-func CheckPassword(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+// RevokeTokenRequest identifies an access token to revoke by its jti claim
+type RevokeTokenRequest struct {
+	TokenID string `json:"token_id"`
+	UserID  string `json:"user_id"`
+}
+
+// Revocations lists the access tokens that are revoked but not yet expired
+type Revocations struct {
+	// Revoked token IDs mapped to when the token expires
+	Tokens map[string]time.Time `json:"tokens"`
+
+	// User IDs mapped to the time before which all their tokens are revoked
+	Users map[string]time.Time `json:"users"`
+
+	// Revoked session IDs mapped to when the last token issued to the session expires
+	Sessions map[string]time.Time `json:"sessions"`
+}
+
+// ClientInfo describes the client a login session is started or refreshed from
+type ClientInfo struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
+
+// Session is a login session of a user on one device; it lasts as long as its refresh tokens
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"` // last login or token refresh
+	Current    bool      `json:"current"`      // the session of the token making the request
+}
+
+// SSOCallbackRequest passes on the authorization response of an identity provider
+type SSOCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// SSOProviders lists the identity providers users can log in with
+type SSOProviders struct {
+	Providers []string `json:"providers"`
+}
+
+// ServiceClient is a bot or internal system that authenticates with the client credentials grant
+type ServiceClient struct {
+	ID        string     `json:"client_id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// Only returned when the client is created
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// CreateServiceClientRequest registers a service client
+type CreateServiceClientRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// TokenResponse is the OAuth 2.0 token response of the client credentials grant
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// RoomRole is a role granted to a user or service client in a room
+type RoomRole struct {
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// RoomBatchRequest lists the rooms whose roles the caller resolves at once
+type RoomBatchRequest struct {
+	RoomIDs []string `json:"room_ids"`
+}
+
+// RoleRequest sets a global or room role
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Kinds of room sanctions
+const (
+	SanctionKick = "kick"
+	SanctionBan  = "ban"
+	SanctionMute = "mute"
+)
+
+// Sanction is a kick, ban or mute of a user in a room
+type Sanction struct {
+	ID        string     `json:"id"`
+	RoomID    string     `json:"room_id"`
+	UserID    string     `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // bans without expiry are permanent
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SanctionRequest kicks, bans or mutes a user in a room
+type SanctionRequest struct {
+	UserID   string `json:"user_id"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"` // e.g. "10m"; required for mutes, bans without one are permanent
 }
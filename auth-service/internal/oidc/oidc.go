@@ -0,0 +1,283 @@
+// internal/oidc/oidc.go
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Time allowed for requests to the identity provider
+const requestTimeout = 10 * time.Second
+
+// ErrInvalidIDToken is returned when the provider's ID token does not verify
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Identity is the user the identity provider authenticated
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// idTokenClaims are the ID token claims used to identify the user
+type idTokenClaims struct {
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // some providers send a string
+	PreferredUsername string      `json:"preferred_username"`
+	Name              string      `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect identity provider, used with the authorization code flow
+// and PKCE. Its endpoints are discovered on first use, so a provider that is down at
+// startup does not keep the service from starting.
+type Provider struct {
+	config config.OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	authURL       string
+	tokenURL      string
+	keys          *auth.JWKSCache
+	signingMethod []string
+}
+
+// NewProvider creates a provider from its configuration
+func NewProvider(cfg config.OIDCProviderConfig) *Provider {
+	hasOpenID := false
+	for _, scope := range cfg.Scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+
+	return &Provider{
+		config: cfg,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// NewProviders creates the configured providers, keyed by name
+func NewProviders(cfgs []config.OIDCProviderConfig) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfgs))
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = NewProvider(cfg)
+	}
+	return providers
+}
+
+// Name returns the provider's configured name
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the URL of the provider's login page. state and nonce tie the
+// response to this login and codeChallenge is the S256 PKCE challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the verified
+// ID token, which must carry nonce
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		// Public clients identify themselves in the form instead of authenticating
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("token response has no ID token")
+	}
+
+	return p.verify(body.IDToken, nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce
+func (p *Provider) verify(rawToken, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, p.keys.Keyfunc, jwt.WithValidMethods(p.signingMethod))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	verified, _ := claims.EmailVerified.(bool)
+	if s, ok := claims.EmailVerified.(string); ok {
+		verified = s == "true"
+	}
+
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     verified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// discover fetches the provider's metadata unless it has been fetched before
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("discovering %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovering %s: unexpected status %s", p.config.Name, resp.Status)
+	}
+
+	var metadata struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		TokenEndpoint         string   `json:"token_endpoint"`
+		JWKSURI               string   `json:"jwks_uri"`
+		SigningAlgValues      []string `json:"id_token_signing_alg_values_supported"`
+		CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&metadata); err != nil {
+		return fmt.Errorf("discovering %s: %w", p.config.Name, err)
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return fmt.Errorf("discovering %s: issuer %q does not match", p.config.Name, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return fmt.Errorf("discovering %s: incomplete provider metadata", p.config.Name)
+	}
+
+	// Only the algorithms the key cache understands; never "none" or HMAC
+	for _, alg := range metadata.SigningAlgValues {
+		if alg == jwt.SigningMethodRS256.Alg() || alg == jwt.SigningMethodEdDSA.Alg() {
+			p.signingMethod = append(p.signingMethod, alg)
+		}
+	}
+	if len(p.signingMethod) == 0 {
+		p.signingMethod = []string{jwt.SigningMethodRS256.Alg()}
+	}
+
+	p.authURL = metadata.AuthorizationEndpoint
+	p.tokenURL = metadata.TokenEndpoint
+	p.keys = auth.NewJWKSCacheURL(metadata.JWKSURI)
+	return nil
+}
+
+// NewPKCE returns a random PKCE code verifier and its S256 code challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns 256 random bits, URL-safe encoded, for states, nonces and verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,153 @@
+// internal/oidc/oidc_test.go
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc/oidctest"
+)
+
+// startLogin starts a login with a fresh state, nonce and PKCE verifier and signs in at
+// the stand-in provider as identity. It returns the code and the login's secrets.
+func startLogin(t *testing.T, idp *oidctest.Provider, p *Provider, identity oidctest.Identity) (code, verifier, nonce string) {
+	t.Helper()
+
+	state, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, returnedState, err := idp.Login(authURL, identity)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if returnedState != state {
+		t.Fatalf("got state %q back, want %q", returnedState, state)
+	}
+	return code, verifier, nonce
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	p := NewProvider(idp.Config("test"))
+
+	authURL, err := p.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        "the-challenge",
+		"code_challenge_method": "S256",
+		"redirect_uri":          "https://app.example.com/sso/callback",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if scopes := strings.Fields(u.Query().Get("scope")); len(scopes) == 0 || scopes[0] != "openid" {
+		t.Errorf("scope = %q, want openid first", u.Query().Get("scope"))
+	}
+}
+
+func TestExchange(t *testing.T) {
+	for _, secret := range []string{"secret", ""} {
+		idp := oidctest.NewProvider("client", secret)
+		defer idp.Close()
+		p := NewProvider(idp.Config("test"))
+
+		code, verifier, nonce := startLogin(t, idp, p, oidctest.Identity{
+			Subject:           "user-1",
+			Email:             "Alice@Example.com",
+			EmailVerified:     true,
+			PreferredUsername: "alice",
+			Name:              "Alice",
+		})
+		identity, err := p.Exchange(context.Background(), code, verifier, nonce)
+		if err != nil {
+			t.Fatalf("client secret %q: Exchange: %v", secret, err)
+		}
+		want := Identity{Subject: "user-1", Email: "Alice@Example.com", EmailVerified: true, PreferredUsername: "alice", Name: "Alice"}
+		if *identity != want {
+			t.Errorf("client secret %q: got identity %+v, want %+v", secret, *identity, want)
+		}
+
+		// Codes are single use
+		if _, err := p.Exchange(context.Background(), code, verifier, nonce); err == nil {
+			t.Errorf("client secret %q: redeemed a code twice", secret)
+		}
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	p := NewProvider(idp.Config("test"))
+
+	code, _, nonce := startLogin(t, idp, p, oidctest.Identity{Subject: "user-1"})
+	other, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(context.Background(), code, other, nonce); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("got error %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity oidctest.Identity
+		nonce    string // passed to Exchange instead of the login's nonce when set
+	}{
+		{name: "wrong issuer", identity: oidctest.Identity{Subject: "user-1", Issuer: "https://evil.example.com"}},
+		{name: "wrong audience", identity: oidctest.Identity{Subject: "user-1", Audience: "other-client"}},
+		{name: "bad signature", identity: oidctest.Identity{Subject: "user-1", ForeignKey: true}},
+		{name: "nonce replaced", identity: oidctest.Identity{Subject: "user-1", Nonce: "replayed"}},
+		{name: "nonce of another login", identity: oidctest.Identity{Subject: "user-1"}, nonce: "another"},
+		{name: "missing subject", identity: oidctest.Identity{}},
+	}
+
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	p := NewProvider(idp.Config("test"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, verifier, nonce := startLogin(t, idp, p, tt.identity)
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			_, err := p.Exchange(context.Background(), code, verifier, nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("got error %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
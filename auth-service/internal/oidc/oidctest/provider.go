@@ -0,0 +1,275 @@
+// internal/oidc/oidctest/provider.go
+
+// Package oidctest provides a local OpenID Connect provider for tests. It implements
+// discovery, the JWKS and the token endpoint of the authorization code flow with PKCE;
+// the login page is replaced by Login, which stands in for the user signing in.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyID is the ID of the provider's signing key in its JWKS
+const keyID = "oidctest"
+
+// Identity is the user a login signs in as, and how the ID token for it is issued
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+
+	// Replace the ID token's iss, aud or nonce claims when set
+	Issuer   string
+	Audience string
+	Nonce    string
+
+	// Signs the ID token with a key that is not in the JWKS, under the published key ID
+	ForeignKey bool
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	identity      Identity
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// Provider is a running stand-in identity provider
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string // empty for a public client
+
+	key     ed25519.PrivateKey
+	foreign ed25519.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// NewProvider starts a provider for one client; Close stops it
+func NewProvider(clientID, clientSecret string) *Provider {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	_, foreign, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		foreign:      foreign,
+		grants:       make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Close stops the provider
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Issuer returns the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// Config returns the configuration of the provider under the given name
+func (p *Provider) Config(name string) config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Name:         name,
+		Issuer:       p.Issuer(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  "https://app.example.com/sso/callback",
+	}
+}
+
+// Login stands in for the user signing in as identity on the login page at authURL. It
+// checks the request as the provider would and returns the code and state the browser is
+// sent back with.
+func (p *Provider) Login(authURL string, identity Identity) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	switch {
+	case u.Scheme+"://"+u.Host+u.Path != p.Server.URL+"/authorize":
+		return "", "", fmt.Errorf("unexpected authorization endpoint %s", u.Path)
+	case q.Get("response_type") != "code":
+		return "", "", fmt.Errorf("unexpected response_type %q", q.Get("response_type"))
+	case q.Get("client_id") != p.ClientID:
+		return "", "", fmt.Errorf("unexpected client_id %q", q.Get("client_id"))
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("missing S256 code challenge")
+	case q.Get("state") == "" || q.Get("nonce") == "":
+		return "", "", errors.New("missing state or nonce")
+	}
+
+	code = rand.Text()
+	p.mu.Lock()
+	p.grants[code] = grant{
+		identity:      identity,
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		redirectURI:   q.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+	return code, q.Get("state"), nil
+}
+
+// discovery serves the provider metadata
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Server.URL + "/authorize",
+		"token_endpoint":                        p.Server.URL + "/token",
+		"jwks_uri":                              p.Server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{jwt.SigningMethodEdDSA.Alg()},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// jwks serves the public key that signs ID tokens
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	public := p.key.Public().(ed25519.PublicKey)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": keyID,
+			"use": "sig",
+			"alg": jwt.SigningMethodEdDSA.Alg(),
+			"x":   base64.RawURLEncoding.EncodeToString(public),
+		}},
+	})
+}
+
+// token redeems an authorization code for an ID token
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if p.ClientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != p.ClientID || secret != p.ClientSecret {
+			tokenError(w, http.StatusUnauthorized, "invalid_client")
+			return
+		}
+		clientID = id
+	}
+	if clientID != p.ClientID {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Codes are used once
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	idToken, err := p.idToken(g)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// idToken signs the ID token of a grant
+func (p *Provider) idToken(g grant) (string, error) {
+	id := g.identity
+	issuer, audience, nonce := p.Issuer(), p.ClientID, g.nonce
+	if id.Issuer != "" {
+		issuer = id.Issuer
+	}
+	if id.Audience != "" {
+		audience = id.Audience
+	}
+	if id.Nonce != "" {
+		nonce = id.Nonce
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"iss":                issuer,
+		"sub":                id.Subject,
+		"aud":                audience,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              nonce,
+		"email":              id.Email,
+		"email_verified":     id.EmailVerified,
+		"preferred_username": id.PreferredUsername,
+		"name":               id.Name,
+	})
+	token.Header["kid"] = keyID
+
+	key := p.key
+	if id.ForeignKey {
+		key = p.foreign
+	}
+	return token.SignedString(key)
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// tokenError writes an OAuth 2.0 error response
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
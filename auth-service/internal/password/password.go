@@ -0,0 +1,68 @@
+// internal/password/password.go
+package password
+
+import (
+	"errors"
+)
+
+// ErrUnknownHash is returned when no hasher recognizes a stored hash
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher hashes passwords with one algorithm. Hashes are self-describing strings that
+// carry the algorithm and its parameters, so hashes made with older settings can still be
+// verified.
+type Hasher interface {
+	// Hash hashes a password with the hasher's current parameters
+	Hash(password string) (string, error)
+
+	// Recognizes reports whether encoded is a hash of this hasher's algorithm
+	Recognizes(encoded string) bool
+
+	// Verify reports whether password matches encoded, a hash this hasher recognizes
+	Verify(password, encoded string) (bool, error)
+
+	// NeedsRehash reports whether encoded was made with weaker parameters than the
+	// hasher's current ones
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes new passwords with the preferred hasher and verifies hashes made by any
+// of the hashers it knows
+type Manager struct {
+	preferred Hasher
+	hashers   []Hasher
+}
+
+// NewManager creates a Manager that hashes with preferred and also verifies hashes made
+// by the legacy hashers
+func NewManager(preferred Hasher, legacy ...Hasher) *Manager {
+	return &Manager{
+		preferred: preferred,
+		hashers:   append([]Hasher{preferred}, legacy...),
+	}
+}
+
+// Hash hashes a password with the preferred hasher
+func (m *Manager) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify reports whether password matches encoded, and whether encoded should be replaced
+// with a hash of the preferred hasher now that the password is known. Empty hashes, such as
+// those of accounts created through single sign-on, never match.
+func (m *Manager) Verify(password, encoded string) (match, rehash bool, err error) {
+	if encoded == "" {
+		return false, false, nil
+	}
+	for _, h := range m.hashers {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+		match, err := h.Verify(password, encoded)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, h != m.preferred || h.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownHash
+}
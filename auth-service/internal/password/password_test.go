@@ -0,0 +1,212 @@
+// internal/password/password_test.go
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; the format does not depend on them
+func newTestArgon2id() *Argon2id {
+	return NewArgon2id(64, 1, 1)
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	a := newTestArgon2id()
+
+	encoded, err := a.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$argon2id$v=19$m=64,t=1,p=1$"; !strings.HasPrefix(encoded, want) {
+		t.Errorf("hash %q does not start with %q", encoded, want)
+	}
+	if !a.Recognizes(encoded) {
+		t.Error("hasher does not recognize its own hash")
+	}
+
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.memory != 64 || p.iterations != 1 || p.parallelism != 1 || len(p.salt) != 16 || len(p.key) != 32 {
+		t.Errorf("decoded parameters %+v do not match the hasher's", p)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse", true},
+		{"correct horse ", false},
+		{"Correct horse", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		match, err := a.Verify(tt.password, encoded)
+		if err != nil {
+			t.Fatalf("verifying %q: %v", tt.password, err)
+		}
+		if match != tt.want {
+			t.Errorf("verifying %q: match = %v, want %v", tt.password, match, tt.want)
+		}
+	}
+
+	// Salts are random, so the same password hashes differently every time
+	again, err := a.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encoded {
+		t.Error("two hashes of the same password are identical")
+	}
+}
+
+func TestArgon2idMalformedHashes(t *testing.T) {
+	a := newTestArgon2id()
+	valid, err := a.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"too few fields", "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{"other algorithm", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{"old version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{"garbled parameters", "$argon2id$v=19$m=64;t=1;p=1$" + salt + "$" + key},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{"padded salt", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "==$" + key},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := a.Verify("correct horse", tt.encoded)
+			if err == nil || match {
+				t.Errorf("got match %v, error %v; want an error", match, err)
+			}
+			if !a.NeedsRehash(tt.encoded) {
+				t.Error("malformed hash does not need a rehash")
+			}
+		})
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	old := newTestArgon2id()
+	encoded, err := old.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher *Argon2id
+		want   bool
+	}{
+		{"same parameters", newTestArgon2id(), false},
+		{"more memory", NewArgon2id(128, 1, 1), true},
+		{"more iterations", NewArgon2id(64, 2, 1), true},
+		{"longer key", &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64}, true},
+		{"less memory", NewArgon2id(32, 1, 1), false},
+		{"more parallelism", NewArgon2id(64, 1, 2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(encoded); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	b := NewBcrypt(bcrypt.MinCost)
+	encoded, err := b.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Recognizes(encoded) {
+		t.Errorf("hasher does not recognize its own hash %q", encoded)
+	}
+
+	if match, err := b.Verify("correct horse", encoded); err != nil || !match {
+		t.Errorf("right password: match %v, error %v", match, err)
+	}
+	if match, err := b.Verify("wrong horse", encoded); err != nil || match {
+		t.Errorf("wrong password: match %v, error %v", match, err)
+	}
+	if match, err := b.Verify("correct horse", "$2a$04$tooshort"); err == nil || match {
+		t.Errorf("malformed hash: match %v, error %v; want an error", match, err)
+	}
+
+	if b.NeedsRehash(encoded) {
+		t.Error("hash of the current cost needs a rehash")
+	}
+	if !NewBcrypt(bcrypt.MinCost + 1).NeedsRehash(encoded) {
+		t.Error("hash of a lower cost does not need a rehash")
+	}
+	if !b.NeedsRehash("$2a$04$tooshort") {
+		t.Error("malformed hash does not need a rehash")
+	}
+
+	for _, encoded := range []string{"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5", "plaintext", ""} {
+		if b.Recognizes(encoded) {
+			t.Errorf("bcrypt recognizes %q", encoded)
+		}
+	}
+}
+
+func TestManagerVerify(t *testing.T) {
+	argon := newTestArgon2id()
+	legacy := NewBcrypt(bcrypt.MinCost)
+	m := NewManager(argon, legacy)
+
+	current, err := m.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := legacy.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := NewArgon2id(32, 1, 1).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		encoded    string
+		wantMatch  bool
+		wantRehash bool
+		wantErr    error
+	}{
+		{"preferred hash", "correct horse", current, true, false, nil},
+		{"preferred hash, wrong password", "wrong horse", current, false, false, nil},
+		{"legacy bcrypt hash", "correct horse", old, true, true, nil},
+		{"legacy bcrypt hash, wrong password", "wrong horse", old, false, false, nil},
+		{"weaker preferred hash", "correct horse", weak, true, true, nil},
+		{"no hash", "correct horse", "", false, false, nil},
+		{"unknown hash", "correct horse", "$md5$abc", false, false, ErrUnknownHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := m.Verify(tt.password, tt.encoded)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if match != tt.wantMatch || rehash != tt.wantRehash {
+				t.Errorf("got match %v, rehash %v; want match %v, rehash %v", match, rehash, tt.wantMatch, tt.wantRehash)
+			}
+		})
+	}
+}
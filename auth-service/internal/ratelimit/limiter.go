@@ -0,0 +1,131 @@
+// internal/ratelimit/limiter.go
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// LimitError is returned when an attempt is refused
+type LimitError struct {
+	RetryAfter time.Duration
+	Locked     bool // the account is locked, rather than the client rate limited
+}
+
+func (e *LimitError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account locked, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many attempts, retry after %s", e.RetryAfter)
+}
+
+// LoginConfig configures a LoginLimiter
+type LoginConfig struct {
+	// Attempts allowed per client IP within Window
+	IPLimit int
+
+	// Failed attempts allowed per account within Window before it is locked
+	AccountLimit int
+
+	Window          time.Duration
+	LockoutDuration time.Duration
+
+	// Delay after the first failure; it doubles with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// LoginLimiter throttles login attempts per client IP with a sliding window and locks
+// accounts temporarily after repeated failures
+type LoginLimiter struct {
+	store  Store
+	config LoginConfig
+}
+
+// NewLoginLimiter creates a new login limiter
+func NewLoginLimiter(store Store, cfg LoginConfig) *LoginLimiter {
+	return &LoginLimiter{
+		store:  store,
+		config: cfg,
+	}
+}
+
+// CheckIP records an attempt from a client and refuses it if the client made too many
+func (l *LoginLimiter) CheckIP(ctx context.Context, ip string) error {
+	n, err := l.store.Hit(ctx, "ip:"+ip, l.config.Window)
+	if err != nil {
+		return err
+	}
+	if n > l.config.IPLimit {
+		return &LimitError{RetryAfter: l.config.Window}
+	}
+	return nil
+}
+
+// CheckAccount refuses attempts on a locked account
+func (l *LoginLimiter) CheckAccount(ctx context.Context, account string) error {
+	until, err := l.store.LockedUntil(ctx, "account:"+account)
+	if err != nil {
+		return err
+	}
+	if !until.IsZero() {
+		return &LimitError{RetryAfter: time.Until(until), Locked: true}
+	}
+	return nil
+}
+
+// Failure records a failed attempt on an account. It returns how long to delay the
+// response and, if this failure locked the account, when the lock ends.
+func (l *LoginLimiter) Failure(ctx context.Context, account string) (time.Duration, time.Time, error) {
+	key := "account:" + account
+	n, err := l.store.Hit(ctx, key, l.config.Window)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	delay := l.config.BaseDelay
+	for i := 1; i < n && delay < l.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.config.MaxDelay {
+		delay = l.config.MaxDelay
+	}
+
+	if n < l.config.AccountLimit {
+		return delay, time.Time{}, nil
+	}
+
+	until := time.Now().Add(l.config.LockoutDuration)
+	if err := l.store.Lock(ctx, key, until); err != nil {
+		return delay, time.Time{}, err
+	}
+	// The account starts over once the lock ends
+	if err := l.store.Reset(ctx, key); err != nil {
+		return delay, time.Time{}, err
+	}
+	return delay, until, nil
+}
+
+// Success forgets the failed attempts on an account
+func (l *LoginLimiter) Success(ctx context.Context, account string) error {
+	return l.store.Reset(ctx, "account:"+account)
+}
+
+// Run prunes old attempts and locks every interval until ctx is done
+func (l *LoginLimiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Attempts older than the window no longer count towards any limit
+			if err := l.store.Prune(ctx, time.Now().Add(-l.config.Window)); err != nil {
+				log.Printf("Error pruning login attempts: %v", err)
+			}
+		}
+	}
+}
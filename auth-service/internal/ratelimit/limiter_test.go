@@ -0,0 +1,95 @@
+// internal/ratelimit/limiter_test.go
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLimiter() *LoginLimiter {
+	return NewLoginLimiter(NewMemoryStore(), LoginConfig{
+		IPLimit:         3,
+		AccountLimit:    3,
+		Window:          time.Minute,
+		LockoutDuration: 50 * time.Millisecond,
+		BaseDelay:       10 * time.Millisecond,
+		MaxDelay:        25 * time.Millisecond,
+	})
+}
+
+func TestIPLimit(t *testing.T) {
+	l := newTestLimiter()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := l.CheckIP(ctx, "198.51.100.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+
+	var limitErr *LimitError
+	if err := l.CheckIP(ctx, "198.51.100.1"); !errors.As(err, &limitErr) || limitErr.Locked {
+		t.Fatalf("attempt over the limit: got error %v, want a rate limit", err)
+	}
+	if err := l.CheckIP(ctx, "198.51.100.2"); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	l := newTestLimiter()
+	ctx := context.Background()
+
+	wantDelays := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}
+	for i, want := range wantDelays {
+		if err := l.CheckAccount(ctx, "alice"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		delay, until, err := l.Failure(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delay != want {
+			t.Errorf("failure %d: delay %s, want %s", i+1, delay, want)
+		}
+		if locked := !until.IsZero(); locked != (i == len(wantDelays)-1) {
+			t.Errorf("failure %d: locked = %v", i+1, locked)
+		}
+	}
+
+	var limitErr *LimitError
+	if err := l.CheckAccount(ctx, "alice"); !errors.As(err, &limitErr) || !limitErr.Locked {
+		t.Fatalf("locked account: got error %v, want a lock", err)
+	}
+	if err := l.CheckAccount(ctx, "bob"); err != nil {
+		t.Errorf("other account: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := l.CheckAccount(ctx, "alice"); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+	// The failures before the lock no longer count
+	if _, until, err := l.Failure(ctx, "alice"); err != nil || !until.IsZero() {
+		t.Errorf("first failure after the lockout: locked until %v, error %v", until, err)
+	}
+}
+
+func TestSuccessResetsFailures(t *testing.T) {
+	l := newTestLimiter()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := l.Failure(ctx, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Success(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, until, err := l.Failure(ctx, "alice"); err != nil || !until.IsZero() {
+		t.Errorf("failure after a success: locked until %v, error %v", until, err)
+	}
+}
@@ -0,0 +1,87 @@
+// internal/ratelimit/memory.go
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store for a single replica, and for tests
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+	locks    map[string]time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: make(map[string][]time.Time),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+// Hit records an attempt and counts the attempts within the window
+func (s *MemoryStore) Hit(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	start := now.Add(-window)
+
+	// Attempts are appended in order, so the expired ones are at the front
+	attempts := s.attempts[key]
+	i := 0
+	for i < len(attempts) && !attempts[i].After(start) {
+		i++
+	}
+	attempts = append(attempts[i:], now)
+	s.attempts[key] = attempts
+	return len(attempts), nil
+}
+
+// Reset forgets the attempts recorded for key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// Lock locks key until the given time
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = until
+	return nil
+}
+
+// LockedUntil returns when the lock on key ends
+func (s *MemoryStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.locks[key]
+	if !until.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// Prune forgets attempts made and locks ended before the given time
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, attempts := range s.attempts {
+		if len(attempts) == 0 || attempts[len(attempts)-1].Before(before) {
+			delete(s.attempts, key)
+		}
+	}
+	for key, until := range s.locks {
+		if until.Before(before) {
+			delete(s.locks, key)
+		}
+	}
+	return nil
+}
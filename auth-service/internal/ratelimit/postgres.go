@@ -0,0 +1,69 @@
+// internal/ratelimit/postgres.go
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore is a Store shared by all replicas through the login_attempts and
+// login_locks tables
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on db; the tables are created by the auth service
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Hit records an attempt and counts the attempts within the window
+func (s *PostgresStore) Hit(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO login_attempts (key, attempted_at) VALUES ($1, $2)", key, now); err != nil {
+		return 0, err
+	}
+
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM login_attempts WHERE key = $1 AND attempted_at > $2", key, now.Add(-window)).Scan(&n)
+	return n, err
+}
+
+// Reset forgets the attempts recorded for key
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+// Lock locks key until the given time
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO login_locks (key, locked_until) VALUES ($1, $2)
+	ON CONFLICT (key) DO UPDATE SET locked_until = GREATEST(login_locks.locked_until, EXCLUDED.locked_until)
+	`, key, until)
+	return err
+}
+
+// LockedUntil returns when the lock on key ends
+func (s *PostgresStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT locked_until FROM login_locks WHERE key = $1 AND locked_until > NOW()", key).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+// Prune forgets attempts made and locks ended before the given time
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempted_at < $1", before); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_locks WHERE locked_until < $1", before)
+	return err
+}
@@ -0,0 +1,26 @@
+// internal/ratelimit/store.go
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps attempt logs and locks. Replicas that share a store share their limits.
+type Store interface {
+	// Hit records an attempt for key and returns the number of attempts within the window
+	// ending now, including this one
+	Hit(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// Reset forgets the attempts recorded for key
+	Reset(ctx context.Context, key string) error
+
+	// Lock locks key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+
+	// LockedUntil returns when the lock on key ends, or the zero time if it is not locked
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+
+	// Prune forgets attempts made and locks ended before the given time
+	Prune(ctx context.Context, before time.Time) error
+}
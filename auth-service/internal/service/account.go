@@ -0,0 +1,116 @@
+// internal/service/account.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/google/uuid"
+)
+
+// ErrUserNotFound is returned when the requested user does not exist and was never deleted
+var ErrUserNotFound = errors.New("user not found")
+
+// IsAdmin reports whether a user may call admin endpoints. The role is looked up rather
+// than taken from the token, so demoted admins lose access immediately.
+func (s *AuthService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	var admin bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND role = $2)", userID, authz.RoleAdmin).Scan(&admin)
+	return admin, err
+}
+
+// currentClaims returns a copy of a user's claims carrying the role looked up by IsAdmin
+// instead of the one in the token, so room checks made here honour demotions at once
+func (s *AuthService) currentClaims(ctx context.Context, claims *auth.Claims) (*auth.Claims, error) {
+	if claims.Bot {
+		return claims, nil
+	}
+	admin, err := s.IsAdmin(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := *claims
+	current.Roles = []string{authz.RoleUser}
+	if admin {
+		current.Roles = []string{authz.RoleAdmin}
+	}
+	return &current, nil
+}
+
+// DeleteUser removes a user account and announces the deletion so other services can erase
+// the user's data and drop their sessions. requestedBy is the user performing the deletion.
+//
+// Deleting an already deleted user re-publishes the original event, so a request that failed
+// after the row was removed can simply be retried.
+func (s *AuthService) DeleteUser(ctx context.Context, userID, requestedBy string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	event := models.UserEvent{
+		EventType: models.EventUserDeleted,
+		UserID:    userID,
+		Timestamp: time.Now(),
+	}
+	if requestedBy != userID {
+		event.ActorID = requestedBy
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM room_roles WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 1 {
+		event.EventID = uuid.New().String()
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO user_deletions (user_id, event_id, requested_by, deleted_at) VALUES ($1, $2, $3, $4)",
+			userID, event.EventID, requestedBy, event.Timestamp)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Already deleted: reuse the recorded event so consumers can de-duplicate
+		err = tx.QueryRowContext(ctx, "SELECT event_id, requested_by, deleted_at FROM user_deletions WHERE user_id = $1", userID).
+			Scan(&event.EventID, &requestedBy, &event.Timestamp)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		event.ActorID = ""
+		if requestedBy != userID {
+			event.ActorID = requestedBy
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("User %s deleted (requested by %s, event %s)", userID, requestedBy, event.EventID)
+	if err := s.producer.PublishUserEvent(ctx, event); err != nil {
+		return err
+	}
+
+	// Tokens issued before the deletion must stop working everywhere
+	return s.RevokeUserTokens(ctx, userID, requestedBy)
+}
@@ -0,0 +1,22 @@
+// internal/service/audit.go
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// audit publishes an event to the audit log. The action has already happened by then, so
+// a failed publish is logged instead of failing it.
+func (s *AuthService) audit(ctx context.Context, event models.AuditEvent) {
+	event.EventID = uuid.New().String()
+	event.Service = models.AuditService
+	event.Timestamp = time.Now()
+	if err := s.producer.PublishAuditEvent(ctx, event); err != nil {
+		log.Printf("Error publishing %s audit event: %v", event.Action, err)
+	}
+}
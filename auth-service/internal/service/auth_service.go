@@ -5,24 +5,59 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	"github.com/afzalabbasi/message-service/auth-service/internal/encryption"
+	"github.com/afzalabbasi/message-service/auth-service/internal/mail"
 	"github.com/afzalabbasi/message-service/auth-service/internal/middleware"
 	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/afzalabbasi/message-service/auth-service/internal/password"
+	"github.com/afzalabbasi/message-service/auth-service/internal/ratelimit"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// ErrInvalidCredentials is returned by Login when the account or password is wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Unique constraints of the users table, named by PostgreSQL's defaults
+const (
+	usersUsernameKey      = "users_username_key"
+	usersUsernameLowerKey = "idx_users_username_lower"
+	usersEmailKey         = "users_email_key"
+	usersEmailLowerKey    = "idx_users_email_lower"
+)
+
+// Publisher publishes user and audit events; kafka.Producer implements it
+type Publisher interface {
+	PublishUserEvent(ctx context.Context, event models.UserEvent) error
+	PublishAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
 // AuthService handles authentication business logic
 type AuthService struct {
 	db            *sql.DB
 	jwtMiddleware *middleware.JWTMiddleware
+	producer      Publisher
+	mailer        mail.Mailer
+	limiter       *ratelimit.LoginLimiter
+	cipher        *encryption.Cipher // nil if two-factor authentication is unavailable
+	passwords     *validation.PasswordPolicy
+	hasher        *password.Manager
+	dummyHash     string // verified against when there is no password hash to check
+	providers     map[string]*oidc.Provider
 	config        *config.Config
 }
 
 // NewAuthService creates a new AuthService
-func NewAuthService(cfg *config.Config) *AuthService {
+func NewAuthService(cfg *config.Config, jwtMiddleware *middleware.JWTMiddleware, producer Publisher, mailer mail.Mailer, providers map[string]*oidc.Provider) *AuthService {
 	db, err := sql.Open("postgres", cfg.PostgresURL)
 	if err != nil {
 		panic(err)
@@ -38,11 +73,70 @@ func NewAuthService(cfg *config.Config) *AuthService {
 		panic(err)
 	}
 
-	return &AuthService{
+	// ADMIN_USER_IDS only bootstraps admins; roles are managed through the admin API after that
+	if len(cfg.AdminUserIDs) > 0 {
+		if _, err := db.Exec("UPDATE users SET role = $1 WHERE id = ANY($2) AND role <> $1",
+			authz.RoleAdmin, pq.Array(cfg.AdminUserIDs)); err != nil {
+			panic(err)
+		}
+	}
+
+	// Throttle logins, sharing the limits between replicas through Postgres by default
+	var store ratelimit.Store = ratelimit.NewPostgresStore(db)
+	if cfg.LoginLimitStore == "memory" {
+		store = ratelimit.NewMemoryStore()
+	}
+	limiter := ratelimit.NewLoginLimiter(store, ratelimit.LoginConfig{
+		IPLimit:         cfg.LoginIPLimit,
+		AccountLimit:    cfg.LoginAccountLimit,
+		Window:          cfg.LoginWindow,
+		LockoutDuration: cfg.LoginLockoutDuration,
+		BaseDelay:       250 * time.Millisecond,
+		MaxDelay:        cfg.LoginMaxDelay,
+	})
+
+	// Two-factor secrets are encrypted at rest; without a key 2FA cannot be enrolled
+	var cipher *encryption.Cipher
+	if cfg.TOTPEncryptionKey != "" {
+		cipher, err = encryption.NewCipher(cfg.TOTPEncryptionKey)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	passwords, err := validation.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordMinClasses, cfg.BreachedPasswordsFile)
+	if err != nil {
+		panic(err)
+	}
+
+	// Hashes of the other algorithm still verify, and are replaced at the next login
+	bcryptHasher := password.NewBcrypt(cfg.BcryptCost)
+	argon2Hasher := password.NewArgon2id(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	hasher := password.NewManager(argon2Hasher, bcryptHasher)
+	if cfg.PasswordHasher == "bcrypt" {
+		hasher = password.NewManager(bcryptHasher, argon2Hasher)
+	}
+	dummyHash, err := hasher.Hash("no account has this password")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &AuthService{
 		db:            db,
-		jwtMiddleware: middleware.NewJWTMiddleware(cfg.JWTSecret),
+		jwtMiddleware: jwtMiddleware,
+		producer:      producer,
+		mailer:        mailer,
+		limiter:       limiter,
+		cipher:        cipher,
+		passwords:     passwords,
+		hasher:        hasher,
+		dummyHash:     dummyHash,
+		providers:     providers,
 		config:        cfg,
 	}
+	jwtMiddleware.Verifier.IsRevoked = s.IsTokenRevoked
+
+	return s
 }
 
 // Initialize database tables
@@ -58,25 +152,227 @@ func initDB(db *sql.DB) error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+	CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users(lower(username) text_pattern_ops);
+	CREATE INDEX IF NOT EXISTS idx_users_email_prefix ON users(lower(email) text_pattern_ops);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(500);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+	-- user_id is a user or a service client, so it has no foreign key
+	CREATE TABLE IF NOT EXISTS room_roles (
+		room_id VARCHAR(36) NOT NULL,
+		user_id VARCHAR(36) NOT NULL,
+		role VARCHAR(20) NOT NULL,
+		granted_by VARCHAR(36) NOT NULL,
+		granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (room_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_room_roles_user_id ON room_roles(user_id);
+
+	CREATE TABLE IF NOT EXISTS room_sanctions (
+		id VARCHAR(36) PRIMARY KEY,
+		room_id VARCHAR(36) NOT NULL,
+		user_id VARCHAR(36) NOT NULL,
+		kind VARCHAR(10) NOT NULL,
+		reason VARCHAR(500),
+		expires_at TIMESTAMP,
+		created_by VARCHAR(36) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		lifted_at TIMESTAMP,
+		lifted_by VARCHAR(36)
+	);
+	CREATE INDEX IF NOT EXISTS idx_room_sanctions_room_user ON room_sanctions(room_id, user_id);
+
+	CREATE TABLE IF NOT EXISTS email_tokens (
+		token_hash CHAR(64) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		purpose VARCHAR(20) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		used_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id);
+
+	CREATE TABLE IF NOT EXISTS user_deletions (
+		user_id VARCHAR(36) PRIMARY KEY,
+		event_id VARCHAR(36) NOT NULL,
+		requested_by VARCHAR(36) NOT NULL,
+		deleted_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id VARCHAR(36) PRIMARY KEY,
+		family_id VARCHAR(36) NOT NULL,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash CHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		rotated_at TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		device_name VARCHAR(100) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		ip_address VARCHAR(45) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		revoked_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_by VARCHAR(36) NOT NULL,
+		revoked_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+	CREATE TABLE IF NOT EXISTS user_totp (
+		user_id VARCHAR(36) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret_encrypted TEXT NOT NULL,
+		last_used_step BIGINT,
+		enabled_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash CHAR(64) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		used_at TIMESTAMP,
+		PRIMARY KEY (user_id, code_hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_identities (
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		email VARCHAR(100),
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_login_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (provider, subject)
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+	CREATE TABLE IF NOT EXISTS oidc_login_states (
+		state_hash CHAR(64) PRIMARY KEY,
+		provider VARCHAR(50) NOT NULL,
+		nonce VARCHAR(64) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS connection_tickets (
+		ticket_hash CHAR(64) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL,
+		claims TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS service_clients (
+		id VARCHAR(36) PRIMARY KEY,
+		name VARCHAR(50) NOT NULL,
+		secret_hash CHAR(64) NOT NULL,
+		scopes TEXT NOT NULL,
+		created_by VARCHAR(36) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		revoked_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		key VARCHAR(150) NOT NULL,
+		attempted_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_key ON login_attempts(key, attempted_at);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_attempted_at ON login_attempts(attempted_at);
+
+	CREATE TABLE IF NOT EXISTS login_locks (
+		key VARCHAR(150) PRIMARY KEY,
+		locked_until TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS user_token_revocations (
+		user_id VARCHAR(36) PRIMARY KEY,
+		revoked_before TIMESTAMP NOT NULL,
+		revoked_by VARCHAR(36) NOT NULL
+	);
 	`
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+	if err := createLowerIndex(db, usersEmailLowerKey, "email"); err != nil {
+		return err
+	}
+	return createLowerIndex(db, usersUsernameLowerKey, "username")
 }
 
-// Register registers a new user
-func (s *AuthService) Register(ctx context.Context, req models.AuthRequest) (*models.AuthResponse, error) {
-	// Check if user already exists
-	var count int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2", req.Username, req.Email).Scan(&count)
+// createLowerIndex makes a column of the users table unique regardless of case. Emails are
+// stored case folded and usernames are compared case-insensitively, but older rows may
+// clash, and accounts whose values differ only in case have to be merged or renamed by
+// hand before the index can be created: either may be the one in use.
+func createLowerIndex(db *sql.DB, index, column string) error {
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", index).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT lower(%[1]s), string_agg(id, ', ' ORDER BY created_at, id)
+	FROM users
+	GROUP BY lower(%[1]s)
+	HAVING COUNT(*) > 1
+	ORDER BY 1
+	`, column))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer rows.Close()
+
+	var duplicates []string
+	for rows.Next() {
+		var value, ids string
+		if err := rows.Scan(&value, &ids); err != nil {
+			return err
+		}
+		duplicates = append(duplicates, fmt.Sprintf("%s (users %s)", value, ids))
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	if count > 0 {
-		return nil, errors.New("user already exists")
+	if len(duplicates) > 0 {
+		return fmt.Errorf("cannot create unique index %s: %d %ss are shared by several users when compared case-insensitively; merge or rename these accounts first: %s",
+			index, len(duplicates), column, strings.Join(duplicates, "; "))
+	}
+
+	_, err = db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON users(lower(%s))", index, column))
+	return err
+}
+
+// Register registers a new user. Invalid fields are reported as validation.Errors.
+func (s *AuthService) Register(ctx context.Context, req models.AuthRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	var fields validation.Errors
+	fields.Add(validation.Username("username", req.Username))
+	email, emailErr := validation.NormalizeEmail("email", req.Email)
+	fields.Add(emailErr)
+	fields.Add(s.passwords.Check("password", req.Password))
+	if err := fields.Err(); err != nil {
+		return nil, err
 	}
+	req.Email = email
 
 	// Hash the password
-	hashedPassword, err := models.HashPassword(req.Password)
+	hashedPassword, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -84,62 +380,169 @@ func (s *AuthService) Register(ctx context.Context, req models.AuthRequest) (*mo
 	// Generate a new UUID for the user
 	userID := uuid.New().String()
 
-	// Insert the new user
+	// Insert the new user; the unique constraints decide races between registrations
 	_, err = s.db.ExecContext(ctx,
 		"INSERT INTO users (id, username, email, password_hash, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
 		userID, req.Username, req.Email, hashedPassword, time.Now(), time.Now())
 	if err != nil {
-		return nil, err
+		return nil, userConflict(err)
 	}
 
-	// Generate a JWT token
-	token, err := s.jwtMiddleware.GenerateToken(userID, req.Username, s.config.JWTExpiration)
-	if err != nil {
-		return nil, err
+	s.audit(ctx, models.AuditEvent{Action: models.AuditUserRegistered, ActorID: userID, IPAddress: client.IPAddress})
+
+	// A failed email must not fail the registration; the user can ask for a new link
+	if err := s.sendVerificationEmail(ctx, userID, req.Email); err != nil {
+		log.Printf("Error creating verification email for user %s: %v", userID, err)
 	}
 
-	return &models.AuthResponse{
-		Token:    token,
-		Username: req.Username,
-		UserID:   userID,
-	}, nil
+	// Unverified users get no tokens if they would not be able to log in either
+	if s.config.RequireEmailVerification {
+		return &models.AuthResponse{
+			Username:                  req.Username,
+			UserID:                    userID,
+			EmailVerificationRequired: true,
+		}, nil
+	}
+
+	// Issue an access token and start a new session
+	return s.issueTokens(ctx, userID, req.Username, client)
 }
 
-// Login authenticates a user
-func (s *AuthService) Login(ctx context.Context, req models.AuthRequest) (*models.AuthResponse, error) {
+// Login authenticates a user. Attempts are throttled per client IP, and accounts are locked
+// for a while after repeated failures.
+func (s *AuthService) Login(ctx context.Context, req models.AuthRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	if err := s.limiter.CheckIP(ctx, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	var user models.User
 
 	// Query by username or email
 	var err error
 	if req.Username != "" {
-		err = s.db.QueryRowContext(ctx, "SELECT id, username, password_hash FROM users WHERE username = $1", req.Username).
-			Scan(&user.ID, &user.Username, &user.Password)
+		err = s.db.QueryRowContext(ctx, "SELECT id, username, password_hash, email_verified_at FROM users WHERE lower(username) = lower($1)", req.Username).
+			Scan(&user.ID, &user.Username, &user.Password, &user.EmailVerifiedAt)
 	} else {
-		err = s.db.QueryRowContext(ctx, "SELECT id, username, password_hash FROM users WHERE email = $1", req.Email).
-			Scan(&user.ID, &user.Username, &user.Password)
+		err = s.db.QueryRowContext(ctx, "SELECT id, username, password_hash, email_verified_at FROM users WHERE lower(email) = $1", validation.CanonicalEmail(req.Email)).
+			Scan(&user.ID, &user.Username, &user.Password, &user.EmailVerifiedAt)
 	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("invalid credentials")
+			// Unknown names take as long as wrong passwords and are throttled like accounts,
+			// so they cannot be told apart
+			s.verifyDummyPassword(req.Password)
+			return nil, s.loginFailed(ctx, "name:"+strings.ToLower(req.Username+req.Email), "", client.IPAddress, ErrInvalidCredentials)
 		}
 		return nil, err
 	}
 
+	if err := s.limiter.CheckAccount(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
 	// Verify password
-	if !models.CheckPassword(req.Password, user.Password) {
-		return nil, errors.New("invalid credentials")
+	match, rehash := s.verifyPassword(user.ID, req.Password, user.Password)
+	if !match {
+		return nil, s.loginFailed(ctx, user.ID, user.ID, client.IPAddress, ErrInvalidCredentials)
+	}
+	if rehash {
+		s.rehashPassword(ctx, user.ID, req.Password, user.Password)
+	}
+
+	if err := s.limiter.Success(ctx, user.ID); err != nil {
+		log.Printf("Error resetting failed logins of user %s: %v", user.ID, err)
 	}
 
-	// Generate a JWT token
-	token, err := s.jwtMiddleware.GenerateToken(user.ID, user.Username, s.config.JWTExpiration)
+	if s.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	// With two-factor authentication the password only earns a challenge for the second step
+	twoFactor, err := s.twoFactorEnabled(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
+	if twoFactor {
+		challenge, err := s.jwtMiddleware.GenerateChallengeToken(user.ID, user.Username, s.config.TwoFactorChallengeExpiration)
+		if err != nil {
+			return nil, err
+		}
+		return &models.AuthResponse{
+			ExpiresIn:         int64(s.config.TwoFactorChallengeExpiration / time.Second),
+			Username:          user.Username,
+			UserID:            user.ID,
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		}, nil
+	}
+
+	// Issue an access token and start a new session
+	return s.login(ctx, user.ID, user.Username, "password", client)
+}
+
+// userConflict maps a unique violation of the users table to the error naming the field
+// that clashed; other errors are returned as is
+func userConflict(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "unique_violation" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case usersUsernameKey, usersUsernameLowerKey:
+		return ErrUsernameTaken
+	case usersEmailKey, usersEmailLowerKey:
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// loginFailed records a failed login, locks the account if it failed too often, and delays
+// the response progressively. It returns failure, or the context's error if the request
+// was canceled during the delay.
+func (s *AuthService) loginFailed(ctx context.Context, account, userID, ip string, failure error) error {
+	delay, lockedUntil, err := s.limiter.Failure(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, models.AuditEvent{
+		Action:    models.AuditLoginFailed,
+		TargetID:  userID,
+		IPAddress: ip,
+		Details:   map[string]string{"reason": failure.Error()},
+	})
+
+	if !lockedUntil.IsZero() && userID != "" {
+		log.Printf("Locked user %s until %s after repeated failed logins from %s", userID, lockedUntil.Format(time.RFC3339), ip)
+		event := models.UserEvent{
+			EventID:   uuid.New().String(),
+			EventType: models.EventAccountLocked,
+			UserID:    userID,
+			Timestamp: time.Now(),
+			ExpiresAt: &lockedUntil,
+			IPAddress: ip,
+		}
+		if err := s.producer.PublishUserEvent(ctx, event); err != nil {
+			log.Printf("Error publishing lockout of user %s: %v", userID, err)
+		}
+		s.audit(ctx, models.AuditEvent{
+			Action:    models.AuditAccountLocked,
+			TargetID:  userID,
+			IPAddress: ip,
+			Details:   map[string]string{"locked_until": lockedUntil.UTC().Format(time.RFC3339)},
+		})
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return failure
+}
 
-	return &models.AuthResponse{
-		Token:    token,
-		Username: user.Username,
-		UserID:   user.ID,
-	}, nil
+// PruneLoginAttempts forgets expired login attempts and locks every interval until ctx is done
+func (s *AuthService) PruneLoginAttempts(ctx context.Context, interval time.Duration) {
+	s.limiter.Run(ctx, interval)
 }
@@ -0,0 +1,145 @@
+// internal/service/clients.go
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidClient is returned for unknown or revoked service clients and wrong secrets
+	ErrInvalidClient = errors.New("invalid client")
+
+	// ErrInvalidScope is returned for unknown scopes or scopes the client was not granted
+	ErrInvalidScope = errors.New("invalid scope")
+
+	// ErrClientNotFound is returned when the requested service client does not exist
+	ErrClientNotFound = errors.New("client not found")
+)
+
+// CreateServiceClient registers a bot or internal system allowed to request tokens with
+// the given scopes. The returned client carries its secret, which is not stored.
+func (s *AuthService) CreateServiceClient(ctx context.Context, req models.CreateServiceClientRequest, createdBy string) (*models.ServiceClient, error) {
+	for _, scope := range req.Scopes {
+		if !auth.IsKnownScope(scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	secret, secretHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &models.ServiceClient{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		Secret:    secret,
+	}
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO service_clients (id, name, secret_hash, scopes, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`, client.ID, client.Name, secretHash, strings.Join(client.Scopes, " "), createdBy, client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Service client %s (%s) created by %s with scopes %v", client.ID, client.Name, createdBy, client.Scopes)
+	return client, nil
+}
+
+// ListServiceClients returns all service clients, including revoked ones
+func (s *AuthService) ListServiceClients(ctx context.Context) ([]models.ServiceClient, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, name, scopes, created_by, created_at, revoked_at FROM service_clients ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.ServiceClient{}
+	for rows.Next() {
+		var client models.ServiceClient
+		var scopes string
+		if err := rows.Scan(&client.ID, &client.Name, &scopes, &client.CreatedBy, &client.CreatedAt, &client.RevokedAt); err != nil {
+			return nil, err
+		}
+		client.Scopes = strings.Fields(scopes)
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// RevokeServiceClient stops a service client from requesting tokens and revokes the
+// tokens it holds
+func (s *AuthService) RevokeServiceClient(ctx context.Context, clientID, revokedBy string) error {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE service_clients SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1", clientID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrClientNotFound
+	}
+
+	log.Printf("Service client %s revoked by %s", clientID, revokedBy)
+	return s.RevokeUserTokens(ctx, clientID, revokedBy)
+}
+
+// IssueClientToken implements the client credentials grant: it issues a machine token
+// for the requested scopes, or for all of the client's scopes if none are requested
+func (s *AuthService) IssueClientToken(ctx context.Context, clientID, secret string, requested []string) (*models.TokenResponse, error) {
+	var name, secretHash, scopes string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, secret_hash, scopes FROM service_clients WHERE id = $1 AND revoked_at IS NULL", clientID).
+		Scan(&name, &secretHash, &scopes)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(secretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	granted := strings.Fields(scopes)
+	if len(requested) == 0 {
+		requested = granted
+	}
+	for _, scope := range requested {
+		found := false
+		for _, g := range granted {
+			found = found || g == scope
+		}
+		if !found {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	token, err := s.jwtMiddleware.GenerateMachineToken(clientID, name, requested, s.config.MachineTokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.config.MachineTokenExpiration / time.Second),
+		Scope:       strings.Join(requested, " "),
+	}, nil
+}
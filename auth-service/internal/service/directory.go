@@ -0,0 +1,70 @@
+// internal/service/directory.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/lib/pq"
+)
+
+// SearchUsers returns a page of the public profiles of users whose username starts with
+// query, or whose email is exactly query, ordered by username. Matching is case-insensitive.
+// Emails are never returned, and only whole addresses match, so results cannot be used to
+// guess someone's address a character at a time.
+func (s *AuthService) SearchUsers(ctx context.Context, query string, limit, offset int) ([]models.Profile, error) {
+	pattern := escapeLike(strings.ToLower(query)) + "%"
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, username, display_name, avatar_url, created_at
+	FROM users
+	WHERE lower(username) LIKE $1 OR lower(email) = $2
+	ORDER BY username, id
+	LIMIT $3 OFFSET $4
+	`, pattern, validation.CanonicalEmail(query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProfiles(rows)
+}
+
+// LookupUsers returns the public profiles of the given users; unknown IDs are left out
+func (s *AuthService) LookupUsers(ctx context.Context, userIDs []string) ([]models.Profile, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, username, display_name, avatar_url, created_at
+	FROM users
+	WHERE id = ANY($1)
+	ORDER BY username, id
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProfiles(rows)
+}
+
+// scanProfiles reads the rows of a profile query
+func scanProfiles(rows *sql.Rows) ([]models.Profile, error) {
+	profiles := []models.Profile{}
+	for rows.Next() {
+		var profile models.Profile
+		var displayName, avatarURL sql.NullString
+		if err := rows.Scan(&profile.ID, &profile.Username, &displayName, &avatarURL, &profile.CreatedAt); err != nil {
+			return nil, err
+		}
+		profile.DisplayName = displayName.String
+		profile.AvatarURL = avatarURL.String
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
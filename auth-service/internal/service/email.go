@@ -0,0 +1,208 @@
+// internal/service/email.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/mail"
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+)
+
+// Purposes of email tokens
+const (
+	emailTokenVerify        = "verify_email"
+	emailTokenResetPassword = "reset_password"
+)
+
+// Time allowed to hand an email to the mailer
+const mailTimeout = 30 * time.Second
+
+var (
+	// ErrInvalidEmailToken is returned for unknown, expired or used email tokens
+	ErrInvalidEmailToken = errors.New("invalid or expired token")
+
+	// ErrEmailNotVerified is returned by Login for unverified accounts when verification is required
+	ErrEmailNotVerified = errors.New("email not verified")
+)
+
+// createEmailToken stores a new single-use token for a user and returns it
+func (s *AuthService) createEmailToken(ctx context.Context, db execer, userID, purpose string, lifetime time.Duration) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO email_tokens (token_hash, user_id, purpose, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)",
+		hash, userID, purpose, time.Now().Add(lifetime), time.Now())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useEmailToken marks a token as used and returns its user. It fails for tokens that are
+// unknown, expired, already used or meant for another purpose.
+func (s *AuthService) useEmailToken(ctx context.Context, tx *sql.Tx, token, purpose string) (string, error) {
+	var userID string
+	err := tx.QueryRowContext(ctx, `
+	UPDATE email_tokens SET used_at = NOW()
+	WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+	RETURNING user_id
+	`, hashToken(token), purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidEmailToken
+	}
+	return userID, err
+}
+
+// sendMail hands an email to the mailer in the background, so the response time does not
+// reveal whether an email was sent
+func (s *AuthService) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending %q email: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// link returns a link to a page of the web app carrying a token
+func (s *AuthService) link(path, token string) string {
+	return s.config.PublicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail sends a new email verification link to a user
+func (s *AuthService) sendVerificationEmail(ctx context.Context, userID, email string) error {
+	token, err := s.createEmailToken(ctx, s.db, userID, emailTokenVerify, s.config.EmailVerificationExpiration)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.",
+			s.link("/verify-email", token), s.config.EmailVerificationExpiration),
+	})
+	return nil
+}
+
+// VerifyEmail marks the email address of the token's user as verified
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.useEmailToken(ctx, tx, token, emailTokenVerify)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResendVerification sends a new verification link to an unverified address. Unknown and
+// verified addresses are ignored, so callers cannot tell which addresses are registered.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, email FROM users WHERE lower(email) = $1 AND email_verified_at IS NULL", validation.CanonicalEmail(email)).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.sendVerificationEmail(ctx, userID, email)
+}
+
+// ForgotPassword sends a password reset link. Unknown addresses are ignored, so callers
+// cannot tell which addresses are registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	var userID string
+	err := s.db.QueryRowContext(ctx, "SELECT id, email FROM users WHERE lower(email) = $1", validation.CanonicalEmail(email)).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.createEmailToken(ctx, s.db, userID, emailTokenResetPassword, s.config.PasswordResetExpiration)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Choose a new password by opening this link:\n\n%s\n\nThe link expires in %s. "+
+			"If you did not ask to reset your password, you can ignore this email.",
+			s.link("/reset-password", token), s.config.PasswordResetExpiration),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password for the token's user and signs them out everywhere.
+// Following the link also proves the user owns the address, so it counts as verified.
+func (s *AuthService) ResetPassword(ctx context.Context, req models.ResetPasswordRequest, client models.ClientInfo) error {
+	if err := s.passwords.Check("password", req.Password); err != nil {
+		return validation.Errors{*err}
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.useEmailToken(ctx, tx, req.Token, emailTokenResetPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE users SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+	WHERE id = $2
+	`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+
+	// Any other outstanding reset links are void now
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE email_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, emailTokenResetPassword); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.audit(ctx, models.AuditEvent{Action: models.AuditPasswordReset, ActorID: userID, IPAddress: client.IPAddress})
+
+	// Whoever knew the old password must not stay signed in
+	return s.RevokeUserTokens(ctx, userID, userID)
+}
@@ -0,0 +1,242 @@
+// internal/service/moderation.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotModerator is returned when the caller may not moderate the room
+	ErrNotModerator = errors.New("not a moderator of this room")
+
+	// ErrCannotModerate is returned when the target's role is not below the caller's
+	ErrCannotModerate = errors.New("cannot moderate a user with an equal or higher role")
+
+	// ErrSanctionNotFound is returned when lifting a ban or mute that is not in effect
+	ErrSanctionNotFound = errors.New("no such ban or mute")
+)
+
+// sanctionEvents maps sanction kinds to the events announcing them
+var sanctionEvents = map[string]string{
+	models.SanctionKick: models.EventRoomUserKicked,
+	models.SanctionBan:  models.EventRoomUserBanned,
+	models.SanctionMute: models.EventRoomUserMuted,
+}
+
+// liftEvents maps sanction kinds to the events announcing that they were lifted
+var liftEvents = map[string]string{
+	models.SanctionBan:  models.EventRoomUserUnbanned,
+	models.SanctionMute: models.EventRoomUserUnmuted,
+}
+
+// Sanction kicks, bans or mutes a user in a room on behalf of a moderator. A zero duration
+// makes a ban permanent. A new ban or mute replaces the one in effect.
+func (s *AuthService) Sanction(ctx context.Context, claims *auth.Claims, roomID, kind string, req models.SanctionRequest, duration time.Duration) (*models.Sanction, error) {
+	if err := s.checkModerator(ctx, claims, roomID, req.UserID); err != nil {
+		return nil, err
+	}
+
+	sanction := &models.Sanction{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		UserID:    req.UserID,
+		Kind:      kind,
+		Reason:    req.Reason,
+		CreatedBy: claims.UserID,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		expiresAt := sanction.CreatedAt.Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if kind != models.SanctionKick {
+		if _, err := tx.ExecContext(ctx, `
+		UPDATE room_sanctions SET lifted_at = NOW(), lifted_by = $4
+		WHERE room_id = $1 AND user_id = $2 AND kind = $3 AND lifted_at IS NULL
+		`, roomID, req.UserID, kind, claims.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO room_sanctions (id, room_id, user_id, kind, reason, expires_at, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, sanction.ID, roomID, req.UserID, kind, req.Reason, sanction.ExpiresAt, claims.UserID, sanction.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %s %s in room %s by %s", req.UserID, kind, roomID, claims.UserID)
+	details := map[string]string{"reason": req.Reason}
+	if sanction.ExpiresAt != nil {
+		details["expires_at"] = sanction.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	s.audit(ctx, models.AuditEvent{
+		Action:   sanctionEvents[kind],
+		ActorID:  claims.UserID,
+		TargetID: req.UserID,
+		RoomID:   roomID,
+		Details:  details,
+	})
+	err = s.producer.PublishUserEvent(ctx, models.UserEvent{
+		EventID:   uuid.New().String(),
+		EventType: sanctionEvents[kind],
+		UserID:    req.UserID,
+		ActorID:   claims.UserID,
+		Timestamp: sanction.CreatedAt,
+		ExpiresAt: sanction.ExpiresAt,
+		RoomID:    roomID,
+		Reason:    req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sanction, nil
+}
+
+// LiftSanction ends a user's ban or mute in a room on behalf of a moderator
+func (s *AuthService) LiftSanction(ctx context.Context, claims *auth.Claims, roomID, userID, kind string) error {
+	if err := s.checkModerator(ctx, claims, roomID, userID); err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+	UPDATE room_sanctions SET lifted_at = NOW(), lifted_by = $4
+	WHERE room_id = $1 AND user_id = $2 AND kind = $3 AND lifted_at IS NULL
+	AND (expires_at IS NULL OR expires_at > NOW())
+	`, roomID, userID, kind, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSanctionNotFound
+	}
+
+	log.Printf("%s of user %s in room %s lifted by %s", kind, userID, roomID, claims.UserID)
+	s.audit(ctx, models.AuditEvent{Action: liftEvents[kind], ActorID: claims.UserID, TargetID: userID, RoomID: roomID})
+	return s.producer.PublishUserEvent(ctx, models.UserEvent{
+		EventID:   uuid.New().String(),
+		EventType: liftEvents[kind],
+		UserID:    userID,
+		ActorID:   claims.UserID,
+		Timestamp: time.Now(),
+		RoomID:    roomID,
+	})
+}
+
+// RoomSanctions returns the bans and mutes in effect in a room, for its moderators
+func (s *AuthService) RoomSanctions(ctx context.Context, claims *auth.Claims, roomID string) ([]models.Sanction, error) {
+	claims, err := s.currentClaims(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	access, err := s.RoomAccess(ctx, roomID, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !authz.Can(claims, *access, authz.PermModerateRoom) {
+		return nil, ErrNotModerator
+	}
+	return s.activeSanctions(ctx, "AND room_id = $1", roomID)
+}
+
+// ActiveSanctions returns every ban and mute in effect, for services that enforce them
+func (s *AuthService) ActiveSanctions(ctx context.Context) ([]models.Sanction, error) {
+	return s.activeSanctions(ctx, "")
+}
+
+// activeSanctions returns the bans and mutes in effect matching the extra condition
+func (s *AuthService) activeSanctions(ctx context.Context, condition string, args ...interface{}) ([]models.Sanction, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, room_id, user_id, kind, reason, expires_at, created_by, created_at
+	FROM room_sanctions
+	WHERE kind <> 'kick' AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) `+condition+`
+	ORDER BY created_at
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sanctions := []models.Sanction{}
+	for rows.Next() {
+		var sanction models.Sanction
+		var reason sql.NullString
+		if err := rows.Scan(&sanction.ID, &sanction.RoomID, &sanction.UserID, &sanction.Kind, &reason,
+			&sanction.ExpiresAt, &sanction.CreatedBy, &sanction.CreatedAt); err != nil {
+			return nil, err
+		}
+		sanction.Reason = reason.String
+		sanctions = append(sanctions, sanction)
+	}
+	return sanctions, rows.Err()
+}
+
+// checkModerator returns an error unless the caller may moderate the room and outranks
+// the target there. Only admins may moderate admins.
+func (s *AuthService) checkModerator(ctx context.Context, claims *auth.Claims, roomID, targetID string) error {
+	claims, err := s.currentClaims(ctx, claims)
+	if err != nil {
+		return err
+	}
+	access, err := s.RoomAccess(ctx, roomID, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !authz.Can(claims, *access, authz.PermModerateRoom) {
+		return ErrNotModerator
+	}
+
+	callerAdmin := !claims.Bot && claims.HasRole(authz.RoleAdmin)
+	if callerAdmin {
+		return nil
+	}
+	if targetID == claims.UserID {
+		return ErrCannotModerate
+	}
+
+	targetAdmin, err := s.IsAdmin(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	if targetAdmin {
+		return ErrCannotModerate
+	}
+
+	// Service clients with rooms:admin act as moderators
+	callerRank := authz.RoleRank(access.Role)
+	if claims.Bot && claims.HasScope(auth.ScopeRoomsAdmin) {
+		callerRank = authz.RoleRank(authz.RoleModerator)
+	}
+
+	target, err := s.RoomAccess(ctx, roomID, targetID)
+	if err != nil {
+		return err
+	}
+	if authz.RoleRank(target.Role) >= callerRank {
+		return ErrCannotModerate
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// internal/service/passwords.go
+package service
+
+import (
+	"context"
+	"log"
+)
+
+// verifyPassword reports whether a password matches the user's stored hash, and whether the
+// hash should be upgraded. Hashes that cannot be read, such as the empty hash of accounts
+// that only sign in with single sign-on, count as a mismatch that takes as long as any other.
+func (s *AuthService) verifyPassword(userID, password, encoded string) (match, rehash bool) {
+	match, rehash, err := s.hasher.Verify(password, encoded)
+	if err != nil {
+		if encoded != "" {
+			log.Printf("Error verifying password of user %s: %v", userID, err)
+		}
+		s.verifyDummyPassword(password)
+		return false, false
+	}
+	return match, rehash
+}
+
+// verifyDummyPassword spends as long on a password as verifying it against a real hash
+// would, so failures do not reveal whether there was a hash to check
+func (s *AuthService) verifyDummyPassword(password string) {
+	s.hasher.Verify(password, s.dummyHash)
+}
+
+// rehashPassword replaces a user's password hash with one of the preferred algorithm and
+// work factor, unless the password changed in the meantime. Failures only delay the upgrade
+// to the next login.
+func (s *AuthService) rehashPassword(ctx context.Context, userID, password, oldHash string) {
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %v", userID, err)
+		return
+	}
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3", newHash, userID, oldHash); err != nil {
+		log.Printf("Error storing rehashed password of user %s: %v", userID, err)
+	}
+}
@@ -0,0 +1,209 @@
+// internal/service/profile.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUsernameTaken is returned when another account already uses the username
+	ErrUsernameTaken = errors.New("username already taken")
+
+	// ErrEmailTaken is returned when another account already uses the email address
+	ErrEmailTaken = errors.New("email already taken")
+
+	// ErrWrongPassword is returned when the current password given to ChangePassword is wrong
+	ErrWrongPassword = errors.New("current password is incorrect")
+)
+
+// GetUser returns a user's own account
+func (s *AuthService) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	var displayName, avatarURL sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+	SELECT id, username, email, email_verified_at, display_name, avatar_url, created_at, updated_at
+	FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &displayName, &avatarURL, &user.CreatedAt, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.DisplayName = displayName.String
+	user.AvatarURL = avatarURL.String
+	return &user, nil
+}
+
+// GetProfile returns the public profile of a user
+func (s *AuthService) GetProfile(ctx context.Context, userID string) (*models.Profile, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Profile{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+	}, nil
+}
+
+// UpdateProfile applies the fields set in req to a user's account. A new email address has
+// to be verified again, and links sent to the old one stop working.
+func (s *AuthService) UpdateProfile(ctx context.Context, userID string, req models.UpdateProfileRequest) (*models.User, error) {
+	var fields validation.Errors
+	if req.Username != nil {
+		fields.Add(validation.Username("username", *req.Username))
+	}
+	if req.Email != nil {
+		email, err := validation.NormalizeEmail("email", *req.Email)
+		fields.Add(err)
+		req.Email = &email
+	}
+	if req.DisplayName != nil {
+		fields.Add(validation.DisplayName("display_name", *req.DisplayName))
+	}
+	if req.AvatarURL != nil {
+		fields.Add(validation.AvatarURL("avatar_url", *req.AvatarURL))
+	}
+	if err := fields.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var username, email string
+	err = tx.QueryRowContext(ctx, "SELECT username, email FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&username, &email)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Clashes with other accounts are left to the unique constraints, which also catch
+	// concurrent changes
+	if req.Username != nil && *req.Username != username {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET username = $1 WHERE id = $2", *req.Username, userID); err != nil {
+			return nil, userConflict(err)
+		}
+	}
+
+	emailChanged := req.Email != nil && *req.Email != validation.CanonicalEmail(email)
+	if emailChanged {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET email = $1, email_verified_at = NULL WHERE id = $2", *req.Email, userID); err != nil {
+			return nil, userConflict(err)
+		}
+		// Otherwise a verification link sent to the old address would verify the new one,
+		// and a reset link could still take over the account
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE email_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.DisplayName != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET display_name = NULLIF($1, '') WHERE id = $2", *req.DisplayName, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.AvatarURL != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET avatar_url = NULLIF($1, '') WHERE id = $2", *req.AvatarURL, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET updated_at = NOW() WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		if err := s.sendVerificationEmail(ctx, userID, *req.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	// Published whenever a username is given, changed or not, so a request that failed to
+	// publish can simply be retried; applying the event twice does no harm
+	if req.Username != nil {
+		event := models.UserEvent{
+			EventID:   uuid.New().String(),
+			EventType: models.EventUsernameChanged,
+			UserID:    userID,
+			Timestamp: time.Now(),
+			Username:  *req.Username,
+		}
+		if err := s.producer.PublishUserEvent(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetUser(ctx, userID)
+}
+
+// ChangePassword replaces a user's password and revokes every token they hold, then issues
+// new tokens in a new session for the client that made the change. Wrong current passwords
+// count as failed logins, so a stolen access token cannot be used to guess the password.
+func (s *AuthService) ChangePassword(ctx context.Context, userID string, req models.ChangePasswordRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	var username, passwordHash string
+	err := s.db.QueryRowContext(ctx, "SELECT username, password_hash FROM users WHERE id = $1", userID).Scan(&username, &passwordHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.limiter.CheckAccount(ctx, userID); err != nil {
+		return nil, err
+	}
+	if match, _ := s.verifyPassword(userID, req.CurrentPassword, passwordHash); !match {
+		return nil, s.loginFailed(ctx, userID, userID, client.IPAddress, ErrWrongPassword)
+	}
+	if err := s.limiter.Success(ctx, userID); err != nil {
+		log.Printf("Error resetting failed logins of user %s: %v", userID, err)
+	}
+	if err := s.passwords.Check("new_password", req.NewPassword); err != nil {
+		return nil, validation.Errors{*err}
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx,
+		"UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2", hashedPassword, userID); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, models.AuditEvent{Action: models.AuditPasswordChanged, ActorID: userID, IPAddress: client.IPAddress})
+
+	// Every other session ends; the one started here keeps its token
+	if err := s.revokeUserSessions(ctx, userID, userID, "password_changed"); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, userID, username, client)
+}
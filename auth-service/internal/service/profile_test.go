@@ -0,0 +1,102 @@
+// internal/service/profile_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/ratelimit"
+)
+
+func TestEmailChangeInvalidatesEmailTokens(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+
+	user := registerUser(t, s, "mover")
+	verify, err := s.createEmailToken(ctx, s.db, user.UserID, emailTokenVerify, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := s.createEmailToken(ctx, s.db, user.UserID, emailTokenResetPassword, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := uniqueName("moved") + "@example.com"
+	if _, err := s.UpdateProfile(ctx, user.UserID, models.UpdateProfileRequest{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The email change sent a fresh verification link, which is not the old one
+	if err := s.VerifyEmail(ctx, verify); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("old verification link: got error %v, want ErrInvalidEmailToken", err)
+	}
+	err = s.ResetPassword(ctx, models.ResetPasswordRequest{Token: reset, Password: "another-Horse-battery-9"}, models.ClientInfo{})
+	if !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("old reset link: got error %v, want ErrInvalidEmailToken", err)
+	}
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	s, _ := newTestService(t, map[string]string{"LOGIN_ACCOUNT_LIMIT": "2", "LOGIN_MAX_DELAY": "1ms"}, nil)
+	ctx := context.Background()
+
+	user := registerUser(t, s, "guessed")
+	guess := models.ChangePasswordRequest{CurrentPassword: "wrong-Horse-battery-9", NewPassword: "another-Horse-battery-9"}
+	for i := 0; i < 2; i++ {
+		if _, err := s.ChangePassword(ctx, user.UserID, guess, models.ClientInfo{}); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("guess %d: got error %v, want ErrWrongPassword", i+1, err)
+		}
+	}
+
+	// Even the right password is refused while the account is locked
+	guess.CurrentPassword = testPassword
+	var limitErr *ratelimit.LimitError
+	if _, err := s.ChangePassword(ctx, user.UserID, guess, models.ClientInfo{}); !errors.As(err, &limitErr) || !limitErr.Locked {
+		t.Fatalf("after the limit: got error %v, want a lock", err)
+	}
+}
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+
+	registered, err := s.Register(ctx, models.AuthRequest{
+		Username: uniqueName("changer"),
+		Email:    uniqueName("changer") + "@example.com",
+		Password: testPassword,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := s.jwtMiddleware.Verifier.Verify(registered.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := s.ChangePassword(ctx, registered.UserID, models.ChangePasswordRequest{
+		CurrentPassword: testPassword,
+		NewPassword:     "another-Horse-battery-9",
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := s.IsTokenRevoked(ctx, old); err != nil || !revoked {
+		t.Errorf("token from before the change: revoked = %v, error %v", revoked, err)
+	}
+	// Issued within the same second as the old one, but in a session of its own
+	current, err := s.jwtMiddleware.Verifier.Verify(changed.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := s.IsTokenRevoked(ctx, current); err != nil || revoked {
+		t.Errorf("token issued by the change: revoked = %v, error %v", revoked, err)
+	}
+	if _, err := s.Refresh(ctx, registered.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token from before the change: got error %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,150 @@
+// internal/service/register_test.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+)
+
+func TestRegisterConcurrentConflicts(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+
+	const attempts = 8
+	tests := []struct {
+		name    string
+		request func(i int, base string) models.AuthRequest
+		wantErr error
+	}{
+		{
+			name: "same username",
+			request: func(i int, base string) models.AuthRequest {
+				return models.AuthRequest{Username: base, Email: uniqueName("mail") + "@example.com", Password: testPassword}
+			},
+			wantErr: ErrUsernameTaken,
+		},
+		{
+			name: "same username in different case",
+			request: func(i int, base string) models.AuthRequest {
+				username := base
+				if i%2 == 1 {
+					username = strings.ToUpper(username)
+				}
+				return models.AuthRequest{Username: username, Email: uniqueName("mail") + "@example.com", Password: testPassword}
+			},
+			wantErr: ErrUsernameTaken,
+		},
+		{
+			name: "same email in different case",
+			request: func(i int, base string) models.AuthRequest {
+				email := base + "@example.com"
+				if i%2 == 1 {
+					email = strings.ToUpper(email)
+				}
+				return models.AuthRequest{Username: uniqueName("user"), Email: email, Password: testPassword}
+			},
+			wantErr: ErrEmailTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := uniqueName("race")
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			errs := make([]error, attempts)
+			for i := 0; i < attempts; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-start
+					_, errs[i] = s.Register(context.Background(), tt.request(i, base), models.ClientInfo{})
+				}(i)
+			}
+			close(start)
+			wg.Wait()
+
+			succeeded := 0
+			for i, err := range errs {
+				switch {
+				case err == nil:
+					succeeded++
+				case !errors.Is(err, tt.wantErr):
+					t.Errorf("attempt %d: got error %v, want %v", i, err, tt.wantErr)
+				}
+			}
+			if succeeded != 1 {
+				t.Errorf("got %d successful registrations, want 1", succeeded)
+			}
+		})
+	}
+}
+
+func TestCreateLowerIndexRejectsCaseDuplicates(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+
+	// A users table from before emails were case folded, in a schema of its own
+	schema := strings.ReplaceAll(uniqueName("test"), "-", "_")
+	if _, err := s.db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	db, err := sql.Open("postgres", withSearchPath(os.Getenv("TEST_POSTGRES_URL"), schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+	CREATE TABLE users (
+		id VARCHAR(36) PRIMARY KEY,
+		email VARCHAR(100) UNIQUE NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	INSERT INTO users (id, email) VALUES ('1', 'Alice@example.com'), ('2', 'alice@example.com'), ('3', 'bob@example.com');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	err = createLowerIndex(db, usersEmailLowerKey, "email")
+	if err == nil || !strings.Contains(err.Error(), "alice@example.com (users 1, 2)") {
+		t.Fatalf("got error %v, want one naming the duplicate accounts", err)
+	}
+
+	if _, err := db.Exec("UPDATE users SET email = 'alice.old@example.com' WHERE id = '1'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createLowerIndex(db, usersEmailLowerKey, "email"); err != nil {
+		t.Fatalf("creating index after renaming: %v", err)
+	}
+}
+
+func TestLoginUsernameIgnoresCase(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+
+	user := registerUser(t, s, "Mixed")
+	resp, err := s.Login(ctx, models.AuthRequest{Username: strings.ToLower(user.Username), Password: testPassword}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserID != user.UserID {
+		t.Errorf("logged in as %s, want %s", resp.UserID, user.UserID)
+	}
+}
+
+// withSearchPath returns a connection string for the given schema
+func withSearchPath(url, schema string) string {
+	if strings.Contains(url, "?") {
+		return url + "&search_path=" + schema
+	}
+	return url + "?search_path=" + schema
+}
@@ -0,0 +1,214 @@
+// internal/service/revocation.go
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/google/uuid"
+)
+
+// IsTokenRevoked reports whether an access token was revoked individually, with its
+// session or by a revocation of all of its user's tokens
+func (s *AuthService) IsTokenRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `
+	SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		OR EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = $2 AND revoked_before > $3)
+		OR EXISTS (SELECT 1 FROM sessions WHERE id = $4 AND revoked_at IS NOT NULL)
+	`, claims.ID, claims.UserID, issuedAt, claims.SessionID).Scan(&revoked)
+	return revoked, err
+}
+
+// Logout revokes the caller's access token and the refresh token family of the given
+// refresh token or, without one, of the token's session
+func (s *AuthService) Logout(ctx context.Context, claims *auth.Claims, refreshToken string) error {
+	switch {
+	case refreshToken != "":
+		_, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE revoked_at IS NULL
+		AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2)
+		`, hashToken(refreshToken), claims.UserID)
+		if err != nil {
+			return err
+		}
+	case claims.SessionID != "":
+		_, err := s.db.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL",
+			claims.SessionID, claims.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.RevokeToken(ctx, claims.ID, claims.UserID, s.tokenExpiry(claims), claims.UserID)
+}
+
+// RevokeToken revokes a single access token by its jti. Revocations are kept until the
+// token would have expired anyway.
+func (s *AuthService) RevokeToken(ctx context.Context, tokenID, userID string, expiresAt time.Time, revokedBy string) error {
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_by, revoked_at)
+	VALUES ($1, $2, $3, $4, NOW())
+	ON CONFLICT (jti) DO NOTHING
+	`, tokenID, userID, expiresAt, revokedBy)
+	if err != nil {
+		return err
+	}
+
+	// Expired revocations no longer matter
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error pruning revoked tokens: %v", err)
+	}
+
+	event := models.UserEvent{
+		EventID:   uuid.New().String(),
+		EventType: models.EventTokenRevoked,
+		UserID:    userID,
+		Timestamp: time.Now(),
+		TokenID:   tokenID,
+		ExpiresAt: &expiresAt,
+	}
+	if revokedBy != userID {
+		event.ActorID = revokedBy
+	}
+	return s.producer.PublishUserEvent(ctx, event)
+}
+
+// RevokeUserTokens revokes every access and refresh token a user currently holds. Tokens
+// are revoked by their iat, which has second precision, so tokens issued later within the
+// same second are revoked too; flows that issue a replacement token revoke the user's
+// sessions instead.
+func (s *AuthService) RevokeUserTokens(ctx context.Context, userID, revokedBy string) error {
+	// The exact time, to the precision the database keeps
+	now := time.Now().Truncate(time.Microsecond)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO user_token_revocations (user_id, revoked_before, revoked_by)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before, revoked_by = EXCLUDED.revoked_by
+	`, userID, now, revokedBy)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	event := models.UserEvent{
+		EventID:   uuid.New().String(),
+		EventType: models.EventUserTokensRevoked,
+		UserID:    userID,
+		Timestamp: now,
+	}
+	if revokedBy != userID {
+		event.ActorID = revokedBy
+	}
+	return s.producer.PublishUserEvent(ctx, event)
+}
+
+// ActiveRevocations returns the revocations that still affect unexpired tokens, for
+// services that keep their own copy of the revocation list
+func (s *AuthService) ActiveRevocations(ctx context.Context) (*models.Revocations, error) {
+	revocations := &models.Revocations{
+		Tokens:   make(map[string]time.Time),
+		Users:    make(map[string]time.Time),
+		Sessions: make(map[string]time.Time),
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > NOW()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return nil, err
+		}
+		revocations.Tokens[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before now minus their lifetime have expired on their own
+	rows, err = s.db.QueryContext(ctx,
+		"SELECT user_id, revoked_before FROM user_token_revocations WHERE revoked_before > $1",
+		time.Now().Add(-s.AccessTokenLifetime()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		var revokedBefore time.Time
+		if err := rows.Scan(&userID, &revokedBefore); err != nil {
+			return nil, err
+		}
+		revocations.Users[userID] = revokedBefore
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Sessions only hold user tokens, so only their lifetime matters
+	rows, err = s.db.QueryContext(ctx,
+		"SELECT id, revoked_at FROM sessions WHERE revoked_at > $1", time.Now().Add(-s.config.JWTExpiration))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionID string
+		var revokedAt time.Time
+		if err := rows.Scan(&sessionID, &revokedAt); err != nil {
+			return nil, err
+		}
+		revocations.Sessions[sessionID] = revokedAt.Add(s.config.JWTExpiration)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+// AccessTokenLifetime returns how long issued access tokens are valid at most, whether
+// issued to users or service clients
+func (s *AuthService) AccessTokenLifetime() time.Duration {
+	if s.config.MachineTokenExpiration > s.config.JWTExpiration {
+		return s.config.MachineTokenExpiration
+	}
+	return s.config.JWTExpiration
+}
+
+// tokenExpiry returns when the token expires, assuming the configured lifetime if it has no exp
+func (s *AuthService) tokenExpiry(claims *auth.Claims) time.Time {
+	if claims.ExpiresAt != nil {
+		return claims.ExpiresAt.Time
+	}
+	return time.Now().Add(s.AccessTokenLifetime())
+}
@@ -0,0 +1,278 @@
+// internal/service/roles.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInvalidRole is returned for roles that do not exist
+	ErrInvalidRole = errors.New("invalid role")
+
+	// ErrLastAdmin is returned when demoting the only remaining admin
+	ErrLastAdmin = errors.New("cannot remove the last admin")
+
+	// ErrRoleNotFound is returned when the user has no role in the room
+	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrNotRoomManager is returned when the caller may not manage the roles of the room
+	ErrNotRoomManager = errors.New("not allowed to manage roles in this room")
+
+	// ErrCannotManageRole is returned when granting a role above the caller's own or
+	// changing the role of a user whose role is not below the caller's
+	ErrCannotManageRole = errors.New("cannot manage a role above your own")
+)
+
+// SetUserRole changes a user's global role. Demoted users' tokens are revoked, since
+// other services trust the roles in tokens until they expire.
+func (s *AuthService) SetUserRole(ctx context.Context, userID, role, grantedBy string) error {
+	if !authz.IsGlobalRole(role) {
+		return ErrInvalidRole
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current == role {
+		return nil
+	}
+
+	if current == authz.RoleAdmin {
+		// Lock the admins so two concurrent demotions cannot both pass the check
+		var admins int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM (SELECT 1 FROM users WHERE role = $1 FOR UPDATE) a", authz.RoleAdmin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2", role, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Role of user %s changed from %s to %s by %s", userID, current, role, grantedBy)
+	s.audit(ctx, models.AuditEvent{
+		Action:   models.AuditRoleChanged,
+		ActorID:  grantedBy,
+		TargetID: userID,
+		Details:  map[string]string{"from": current, "to": role},
+	})
+	if current == authz.RoleAdmin {
+		return s.RevokeUserTokens(ctx, userID, grantedBy)
+	}
+	return nil
+}
+
+// RoomAccess returns a user's role in a room, whether the room has any roles at all, and
+// the user's ban or mute there
+func (s *AuthService) RoomAccess(ctx context.Context, roomID, userID string) (*authz.RoomAccess, error) {
+	accesses, err := s.RoomAccesses(ctx, []string{roomID}, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &accesses[0], nil
+}
+
+// RoomAccesses returns a user's access to each of several rooms, in the order given
+func (s *AuthService) RoomAccesses(ctx context.Context, roomIDs []string, userID string) ([]authz.RoomAccess, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT r.room_id,
+		(SELECT role FROM room_roles WHERE room_id = r.room_id AND user_id = $2),
+		EXISTS (SELECT 1 FROM room_roles WHERE room_id = r.room_id),
+		EXISTS (SELECT 1 FROM room_sanctions WHERE room_id = r.room_id AND user_id = $2 AND kind = 'ban'
+			AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())),
+		(SELECT MAX(expires_at) FROM room_sanctions WHERE room_id = r.room_id AND user_id = $2 AND kind = 'mute'
+			AND lifted_at IS NULL AND expires_at > NOW())
+	FROM unnest($1::text[]) WITH ORDINALITY AS r(room_id, n)
+	ORDER BY r.n
+	`, pq.Array(roomIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make([]authz.RoomAccess, 0, len(roomIDs))
+	for rows.Next() {
+		access := authz.RoomAccess{UserID: userID}
+		var role sql.NullString
+		var mutedUntil sql.NullTime
+		if err := rows.Scan(&access.RoomID, &role, &access.Managed, &access.Banned, &mutedUntil); err != nil {
+			return nil, err
+		}
+		access.Role = role.String
+		if mutedUntil.Valid {
+			access.MutedUntil = &mutedUntil.Time
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
+
+// ListRoomRoles returns the role assignments of a room
+func (s *AuthService) ListRoomRoles(ctx context.Context, roomID string) ([]models.RoomRole, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT room_id, user_id, role, granted_by, granted_at FROM room_roles WHERE room_id = $1 ORDER BY granted_at", roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.RoomRole{}
+	for rows.Next() {
+		var r models.RoomRole
+		if err := rows.Scan(&r.RoomID, &r.UserID, &r.Role, &r.GrantedBy, &r.GrantedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// SetRoomRole grants a user or service client a role in a room, replacing any role it
+// had there. The first role granted in a room closes it to everyone without a role.
+func (s *AuthService) SetRoomRole(ctx context.Context, roomID, userID, role, grantedBy string) (*models.RoomRole, error) {
+	if !authz.IsRoomRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	r := &models.RoomRole{RoomID: roomID, UserID: userID, Role: role, GrantedBy: grantedBy, GrantedAt: time.Now()}
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO room_roles (room_id, user_id, role, granted_by, granted_at) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (room_id, user_id) DO UPDATE
+	SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by, granted_at = EXCLUDED.granted_at
+	`, r.RoomID, r.UserID, r.Role, r.GrantedBy, r.GrantedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %s granted %s in room %s by %s", userID, role, roomID, grantedBy)
+	s.audit(ctx, models.AuditEvent{
+		Action:   models.AuditRoomRoleGranted,
+		ActorID:  grantedBy,
+		TargetID: userID,
+		RoomID:   roomID,
+		Details:  map[string]string{"role": role},
+	})
+	return r, nil
+}
+
+// RemoveRoomRole revokes a user's role in a room
+func (s *AuthService) RemoveRoomRole(ctx context.Context, roomID, userID, revokedBy string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM room_roles WHERE room_id = $1 AND user_id = $2", roomID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+
+	log.Printf("Role of user %s in room %s revoked by %s", userID, roomID, revokedBy)
+	s.audit(ctx, models.AuditEvent{Action: models.AuditRoomRoleRevoked, ActorID: revokedBy, TargetID: userID, RoomID: roomID})
+	return nil
+}
+
+// ManagedRoomRoles returns the role assignments of a room for a caller allowed to manage them
+func (s *AuthService) ManagedRoomRoles(ctx context.Context, claims *auth.Claims, roomID string) ([]models.RoomRole, error) {
+	if _, _, err := s.roleManagerRank(ctx, claims, roomID); err != nil {
+		return nil, err
+	}
+	return s.ListRoomRoles(ctx, roomID)
+}
+
+// GrantRoomRole grants a role in a room on behalf of a caller allowed to manage its roles.
+// Owners may grant roles up to their own to users ranked below them.
+func (s *AuthService) GrantRoomRole(ctx context.Context, claims *auth.Claims, roomID, userID, role string) (*models.RoomRole, error) {
+	if !authz.IsRoomRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if err := s.checkRoleManager(ctx, claims, roomID, userID, role); err != nil {
+		return nil, err
+	}
+	return s.SetRoomRole(ctx, roomID, userID, role, claims.UserID)
+}
+
+// RevokeRoomRole revokes a role in a room on behalf of a caller allowed to manage its roles
+func (s *AuthService) RevokeRoomRole(ctx context.Context, claims *auth.Claims, roomID, userID string) error {
+	if err := s.checkRoleManager(ctx, claims, roomID, userID, ""); err != nil {
+		return err
+	}
+	return s.RemoveRoomRole(ctx, roomID, userID, claims.UserID)
+}
+
+// roleManagerRank returns the rank of the caller's room role, and whether the caller is an
+// admin, unless the caller may not manage the room's roles
+func (s *AuthService) roleManagerRank(ctx context.Context, claims *auth.Claims, roomID string) (int, bool, error) {
+	claims, err := s.currentClaims(ctx, claims)
+	if err != nil {
+		return 0, false, err
+	}
+	access, err := s.RoomAccess(ctx, roomID, claims.UserID)
+	if err != nil {
+		return 0, false, err
+	}
+	if !authz.Can(claims, *access, authz.PermManageRoomRoles) {
+		return 0, false, ErrNotRoomManager
+	}
+
+	if !claims.Bot && claims.HasRole(authz.RoleAdmin) {
+		return 0, true, nil
+	}
+	// Service clients with rooms:admin act as owners
+	if claims.Bot && claims.HasScope(auth.ScopeRoomsAdmin) {
+		return authz.RoleRank(authz.RoleOwner), false, nil
+	}
+	return authz.RoleRank(access.Role), false, nil
+}
+
+// checkRoleManager returns an error unless the caller may give the target the role, or
+// remove the target's role when it is empty. Only admins may change their own role or
+// that of users ranked at or above them.
+func (s *AuthService) checkRoleManager(ctx context.Context, claims *auth.Claims, roomID, targetID, role string) error {
+	callerRank, callerAdmin, err := s.roleManagerRank(ctx, claims, roomID)
+	if err != nil {
+		return err
+	}
+	if callerAdmin {
+		return nil
+	}
+	if targetID == claims.UserID || authz.RoleRank(role) > callerRank {
+		return ErrCannotManageRole
+	}
+
+	target, err := s.RoomAccess(ctx, roomID, targetID)
+	if err != nil {
+		return err
+	}
+	if authz.RoleRank(target.Role) >= callerRank {
+		return ErrCannotManageRole
+	}
+	return nil
+}
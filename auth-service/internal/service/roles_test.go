@@ -0,0 +1,118 @@
+// internal/service/roles_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/google/uuid"
+)
+
+// registerUser registers a user and returns claims like those of their access tokens
+func registerUser(t *testing.T, s *AuthService, prefix string) *auth.Claims {
+	t.Helper()
+	registered, err := s.Register(context.Background(), models.AuthRequest{
+		Username: uniqueName(prefix),
+		Email:    uniqueName(prefix) + "@example.com",
+		Password: testPassword,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &auth.Claims{UserID: registered.UserID, Username: registered.Username, Roles: []string{authz.RoleUser}}
+}
+
+func TestRoomRoleManagement(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+	roomID := uuid.New().String()
+
+	owner := registerUser(t, s, "owner")
+	coOwner := registerUser(t, s, "coowner")
+	member := registerUser(t, s, "member")
+
+	if _, err := s.GrantRoomRole(ctx, owner, roomID, owner.UserID, authz.RoleOwner); !errors.Is(err, ErrNotRoomManager) {
+		t.Fatalf("granting a role without one: got error %v, want ErrNotRoomManager", err)
+	}
+	if _, err := s.SetRoomRole(ctx, roomID, owner.UserID, authz.RoleOwner, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GrantRoomRole(ctx, owner, roomID, member.UserID, authz.RoleModerator); err != nil {
+		t.Fatalf("owner granting moderator: %v", err)
+	}
+	if _, err := s.GrantRoomRole(ctx, owner, roomID, coOwner.UserID, authz.RoleOwner); err != nil {
+		t.Fatalf("owner granting owner: %v", err)
+	}
+	if err := s.RevokeRoomRole(ctx, coOwner, roomID, owner.UserID); !errors.Is(err, ErrCannotManageRole) {
+		t.Errorf("owner revoking another owner: got error %v, want ErrCannotManageRole", err)
+	}
+	if _, err := s.GrantRoomRole(ctx, member, roomID, member.UserID, authz.RoleOwner); !errors.Is(err, ErrNotRoomManager) {
+		t.Errorf("moderator granting a role: got error %v, want ErrNotRoomManager", err)
+	}
+	if err := s.RevokeRoomRole(ctx, owner, roomID, member.UserID); err != nil {
+		t.Errorf("owner revoking moderator: %v", err)
+	}
+
+	roles, err := s.ManagedRoomRoles(ctx, owner, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Errorf("got %d role assignments, want 2", len(roles))
+	}
+}
+
+func TestRoomChecksIgnoreStaleAdminRole(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+	roomID := uuid.New().String()
+
+	owner := registerUser(t, s, "owner")
+	demoted := registerUser(t, s, "demoted")
+	if _, err := s.SetRoomRole(ctx, roomID, owner.UserID, authz.RoleOwner, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token issued before the user lost the admin role
+	demoted.Roles = []string{authz.RoleAdmin}
+
+	if _, err := s.GrantRoomRole(ctx, demoted, roomID, demoted.UserID, authz.RoleOwner); !errors.Is(err, ErrNotRoomManager) {
+		t.Errorf("granting a role with a stale admin token: got error %v, want ErrNotRoomManager", err)
+	}
+	if err := s.checkModerator(ctx, demoted, roomID, owner.UserID); !errors.Is(err, ErrNotModerator) {
+		t.Errorf("moderating with a stale admin token: got error %v, want ErrNotModerator", err)
+	}
+	if _, err := s.RoomSanctions(ctx, demoted, roomID); !errors.Is(err, ErrNotModerator) {
+		t.Errorf("listing sanctions with a stale admin token: got error %v, want ErrNotModerator", err)
+	}
+}
+
+func TestRoomAccesses(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+	managed, open := uuid.New().String(), uuid.New().String()
+
+	owner := registerUser(t, s, "owner")
+	if _, err := s.SetRoomRole(ctx, managed, owner.UserID, authz.RoleOwner, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	accesses, err := s.RoomAccesses(ctx, []string{open, managed}, owner.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 2 {
+		t.Fatalf("got %d rooms, want 2", len(accesses))
+	}
+	if a := accesses[0]; a.RoomID != open || a.Managed || a.Role != "" {
+		t.Errorf("open room: got %+v", a)
+	}
+	if a := accesses[1]; a.RoomID != managed || !a.Managed || a.Role != authz.RoleOwner {
+		t.Errorf("managed room: got %+v", a)
+	}
+}
@@ -0,0 +1,96 @@
+// internal/service/service_test.go
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	"github.com/afzalabbasi/message-service/auth-service/internal/keys"
+	"github.com/afzalabbasi/message-service/auth-service/internal/mail"
+	"github.com/afzalabbasi/message-service/auth-service/internal/middleware"
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/google/uuid"
+)
+
+// testPublisher records the events published by the service under test
+type testPublisher struct {
+	mu          sync.Mutex
+	userEvents  []models.UserEvent
+	auditEvents []models.AuditEvent
+}
+
+func (p *testPublisher) PublishUserEvent(ctx context.Context, event models.UserEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.userEvents = append(p.userEvents, event)
+	return nil
+}
+
+func (p *testPublisher) PublishAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.auditEvents = append(p.auditEvents, event)
+	return nil
+}
+
+// audited returns the audited actions, in order
+func (p *testPublisher) audited() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var actions []string
+	for _, event := range p.auditEvents {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+// testMailer drops all mail
+type testMailer struct{}
+
+func (testMailer) Send(ctx context.Context, msg mail.Message) error { return nil }
+
+// newTestService creates an AuthService on the database at TEST_POSTGRES_URL, skipping the
+// test if it is not set. env overrides configuration variables. Tests share the database,
+// so they use unique names from uniqueName instead of relying on an empty one.
+func newTestService(t *testing.T, env map[string]string, providers map[string]*oidc.Provider) (*AuthService, *testPublisher) {
+	t.Helper()
+
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	t.Setenv("POSTGRES_URL", url)
+	t.Setenv("LOGIN_LIMIT_STORE", "memory")
+	t.Setenv("PASSWORD_HASHER", "bcrypt")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	keyManager, err := keys.NewManager("", "")
+	if err != nil {
+		t.Fatalf("creating signing key: %v", err)
+	}
+	jwtMiddleware := middleware.NewJWTMiddleware(keyManager, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTLeeway)
+
+	publisher := &testPublisher{}
+	s := NewAuthService(cfg, jwtMiddleware, publisher, testMailer{}, providers)
+	t.Cleanup(func() { s.db.Close() })
+	return s, publisher
+}
+
+// uniqueName returns a valid username that no other test run uses
+func uniqueName(prefix string) string {
+	return prefix + "-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+}
+
+// testPassword satisfies the default password policy
+const testPassword = "correct-Horse-battery-9"
@@ -0,0 +1,172 @@
+// internal/service/sessions.go
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// ErrSessionNotFound is returned when a user has no active session with the given ID
+var ErrSessionNotFound = errors.New("session not found")
+
+// Limits of the client details stored with a session
+const (
+	maxDeviceNameLength = 100
+	maxUserAgentLength  = 512
+)
+
+// ListSessions returns a user's active sessions, most recently used first. currentID is
+// the session of the caller's token, if any.
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentID string) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT s.id, s.device_name, s.user_agent, s.ip_address, s.created_at, s.last_used_at
+	FROM sessions s
+	WHERE s.user_id = $1 AND s.revoked_at IS NULL
+	AND EXISTS (
+		SELECT 1 FROM refresh_tokens t
+		WHERE t.family_id = s.id AND t.rotated_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+	)
+	ORDER BY s.last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt); err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession ends one of a user's sessions: its refresh tokens stop working and the access
+// tokens issued to it are revoked, which disconnects it from the other services
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID, revokedBy string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL",
+		now, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", sessionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.sessionRevoked(ctx, userID, sessionID, revokedBy, now, "")
+}
+
+// revokeUserSessions ends all of a user's sessions as RevokeSession ends one. Unlike
+// RevokeUserTokens it does not go by when tokens were issued, so a session started right
+// afterwards is unaffected. reason is optional.
+func (s *AuthService) revokeUserSessions(ctx context.Context, userID, revokedBy, reason string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx,
+		"UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL RETURNING id", now, userID)
+	if err != nil {
+		return err
+	}
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			rows.Close()
+			return err
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := s.sessionRevoked(ctx, userID, sessionID, revokedBy, now, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionRevoked audits the revocation of a session and publishes it, so that the other
+// services reject its access tokens and close its connections. reason is optional.
+func (s *AuthService) sessionRevoked(ctx context.Context, userID, sessionID, revokedBy string, now time.Time, reason string) error {
+	audit := models.AuditEvent{Action: models.AuditSessionRevoked, ActorID: revokedBy, Details: map[string]string{"session_id": sessionID}}
+	if revokedBy != userID {
+		audit.TargetID = userID
+	}
+	if reason != "" {
+		audit.Details["reason"] = reason
+	}
+	s.audit(ctx, audit)
+
+	// Access tokens of the session were all issued before it was revoked
+	expiresAt := now.Add(s.config.JWTExpiration)
+	event := models.UserEvent{
+		EventID:   uuid.New().String(),
+		EventType: models.EventSessionRevoked,
+		UserID:    userID,
+		Timestamp: now,
+		SessionID: sessionID,
+		ExpiresAt: &expiresAt,
+	}
+	if revokedBy != userID {
+		event.ActorID = revokedBy
+	}
+	return s.producer.PublishUserEvent(ctx, event)
+}
+
+// clip truncates s to at most n bytes without splitting a UTF-8 sequence
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,263 @@
+// internal/service/sso.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/afzalabbasi/message-service/auth-service/internal/validation"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUnknownProvider is returned for identity providers that are not configured
+	ErrUnknownProvider = errors.New("unknown identity provider")
+
+	// ErrInvalidSSOState is returned when the state of a single sign-on callback is unknown or expired
+	ErrInvalidSSOState = errors.New("invalid or expired login state")
+
+	// ErrSSOEmailRequired is returned when the identity provider did not share an email address
+	ErrSSOEmailRequired = errors.New("identity provider did not provide an email address")
+
+	// ErrIdentityConflict is returned when the email address of the identity belongs to an
+	// existing account that cannot be linked: the provider did not verify the address, or
+	// the account is an admin or has 2FA, which a provider login would bypass
+	ErrIdentityConflict = errors.New("an account with this email address already exists")
+)
+
+// SSOProviders returns the names of the configured identity providers
+func (s *AuthService) SSOProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartSSOLogin returns the URL of the identity provider's login page, and a binding the
+// browser must present with the callback, so a login started by someone else cannot be
+// completed in it. The state, nonce and PKCE verifier of the login are kept until the
+// provider redirects back.
+func (s *AuthService) StartSSOLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, hashToken(state), providerName, nonce, verifier, time.Now().Add(s.config.OIDCStateExpiration))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Logins that were never finished no longer matter
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error pruning login states: %v", err)
+	}
+
+	return authURL, hashToken(state), nil
+}
+
+// CompleteSSOLogin redeems the code the identity provider sent back and logs in the user
+// linked to the identity, linking or creating an account on first login. The provider is
+// trusted to have done any multi-factor authentication, so local 2FA is not asked for.
+// binding is the one StartSSOLogin returned to the browser that started the login.
+func (s *AuthService) CompleteSSOLogin(ctx context.Context, providerName string, req models.SSOCallbackRequest, binding string, client models.ClientInfo) (*models.AuthResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(hashToken(req.State))) != 1 {
+		return nil, ErrInvalidSSOState
+	}
+
+	// Each state is used once
+	var nonce, verifier string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+	DELETE FROM oidc_login_states WHERE state_hash = $1 AND provider = $2
+	RETURNING nonce, code_verifier, expires_at
+	`, hashToken(req.State), providerName).Scan(&nonce, &verifier, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidSSOState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, verifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, username, err := s.userForIdentity(ctx, providerName, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %s logged in with %s", userID, providerName)
+	return s.login(ctx, userID, username, "sso:"+providerName, client)
+}
+
+// userForIdentity returns the user linked to an external identity. Unlinked identities are
+// linked to the account with the same email address if the provider verified it, or get a
+// new account otherwise. Admins and accounts with 2FA are never linked this way.
+func (s *AuthService) userForIdentity(ctx context.Context, providerName string, identity *oidc.Identity) (string, string, error) {
+	identity.Email = validation.CanonicalEmail(identity.Email)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var userID, username string
+	err = tx.QueryRowContext(ctx, `
+	SELECT u.id, u.username FROM user_identities i JOIN users u ON u.id = i.user_id
+	WHERE i.provider = $1 AND i.subject = $2
+	`, providerName, identity.Subject).Scan(&userID, &username)
+	if err == nil {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE user_identities SET email = $1, last_login_at = NOW() WHERE provider = $2 AND subject = $3",
+			identity.Email, providerName, identity.Subject)
+		if err != nil {
+			return "", "", err
+		}
+		return userID, username, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return "", "", err
+	}
+
+	if identity.Email == "" {
+		return "", "", ErrSSOEmailRequired
+	}
+
+	var role string
+	var twoFactor bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT id, username, role,
+		EXISTS (SELECT 1 FROM user_totp WHERE user_id = users.id AND enabled_at IS NOT NULL)
+	FROM users WHERE lower(email) = $1 FOR UPDATE
+	`, identity.Email).Scan(&userID, &username, &role, &twoFactor)
+	switch {
+	case err == nil && !identity.EmailVerified:
+		return "", "", ErrIdentityConflict
+	case err == nil && (role == authz.RoleAdmin || twoFactor):
+		// Provider logins skip local 2FA, and an admin account is too valuable to hand to
+		// whoever controls the address at a provider
+		log.Printf("Refused to link %s identity %s to user %s", providerName, identity.Subject, userID)
+		return "", "", ErrIdentityConflict
+	case err == nil:
+		// The provider vouches for the address, so this is the same person
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1", userID); err != nil {
+			return "", "", err
+		}
+	case err == sql.ErrNoRows:
+		userID, username, err = s.createSSOUser(ctx, tx, identity)
+		if err != nil {
+			return "", "", err
+		}
+	default:
+		return "", "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO user_identities (provider, subject, user_id, email, created_at, last_login_at)
+	VALUES ($1, $2, $3, $4, NOW(), NOW())
+	`, providerName, identity.Subject, userID, identity.Email)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	log.Printf("Linked %s identity %s to user %s", providerName, identity.Subject, userID)
+	return userID, username, nil
+}
+
+// createSSOUser creates an account for an external identity. It has no password, so it
+// can only log in through the provider until the user resets their password.
+func (s *AuthService) createSSOUser(ctx context.Context, tx *sql.Tx, identity *oidc.Identity) (string, string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = validation.SanitizeUsername(base, "user")
+	if len(base) > 42 {
+		base = base[:42]
+	}
+
+	// Add a random suffix if the name is taken
+	username := base
+	for attempt := 0; ; attempt++ {
+		var taken bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM users WHERE lower(username) = lower($1))", username).Scan(&taken); err != nil {
+			return "", "", err
+		}
+		if !taken {
+			break
+		}
+		if attempt == 5 {
+			return "", "", ErrUsernameTaken
+		}
+		b := make([]byte, 3)
+		if _, err := rand.Read(b); err != nil {
+			return "", "", err
+		}
+		username = base + "-" + hex.EncodeToString(b)
+	}
+
+	var verifiedAt *time.Time
+	if identity.EmailVerified {
+		now := time.Now()
+		verifiedAt = &now
+	}
+
+	userID := uuid.New().String()
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO users (id, username, email, password_hash, display_name, email_verified_at, created_at, updated_at)
+	VALUES ($1, $2, $3, '', NULLIF($4, ''), $5, NOW(), NOW())
+	`, userID, username, identity.Email, identity.Name, verifiedAt)
+	if err != nil {
+		return "", "", userConflict(err)
+	}
+
+	return userID, username, nil
+}
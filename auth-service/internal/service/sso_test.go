@@ -0,0 +1,181 @@
+// internal/service/sso_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/afzalabbasi/message-service/auth-service/internal/config"
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc"
+	"github.com/afzalabbasi/message-service/auth-service/internal/oidc/oidctest"
+)
+
+// newSSOTestService creates a service with the stand-in provider idp configured as "test"
+func newSSOTestService(t *testing.T) (*AuthService, *oidctest.Provider) {
+	t.Helper()
+
+	idp := oidctest.NewProvider("client", "secret")
+	t.Cleanup(idp.Close)
+	s, _ := newTestService(t, nil, oidc.NewProviders([]config.OIDCProviderConfig{idp.Config("test")}))
+	return s, idp
+}
+
+// ssoLogin signs in at the stand-in provider as identity and completes the login
+func ssoLogin(s *AuthService, idp *oidctest.Provider, identity oidctest.Identity) (*models.AuthResponse, error) {
+	ctx := context.Background()
+	authURL, binding, err := s.StartSSOLogin(ctx, "test")
+	if err != nil {
+		return nil, err
+	}
+	code, state, err := idp.Login(authURL, identity)
+	if err != nil {
+		return nil, err
+	}
+	return s.CompleteSSOLogin(ctx, "test", models.SSOCallbackRequest{Code: code, State: state}, binding, models.ClientInfo{})
+}
+
+func TestSSOLoginCreatesAndReusesAccount(t *testing.T) {
+	s, idp := newSSOTestService(t)
+
+	identity := oidctest.Identity{Subject: uniqueName("sub"), Email: uniqueName("new") + "@example.com", EmailVerified: true, PreferredUsername: "sso.user"}
+	first, err := ssoLogin(s, idp, identity)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if first.Token == "" {
+		t.Fatal("first login issued no token")
+	}
+
+	// The identity is linked by subject from now on, whatever its email address
+	identity.Email = uniqueName("changed") + "@example.com"
+	second, err := ssoLogin(s, idp, identity)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if second.UserID != first.UserID {
+		t.Errorf("second login got user %s, want %s", second.UserID, first.UserID)
+	}
+}
+
+func TestSSOLoginLinksVerifiedEmail(t *testing.T) {
+	s, idp := newSSOTestService(t)
+
+	registered, err := s.Register(context.Background(), models.AuthRequest{
+		Username: uniqueName("local"),
+		Email:    uniqueName("local") + "@example.com",
+		Password: testPassword,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var email string
+	if err := s.db.QueryRow("SELECT email FROM users WHERE id = $1", registered.UserID).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider's spelling of the address may differ in case
+	resp, err := ssoLogin(s, idp, oidctest.Identity{Subject: uniqueName("sub"), Email: "  " + strings.ToUpper(email), EmailVerified: true})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if resp.UserID != registered.UserID {
+		t.Errorf("got user %s, want the registered user %s", resp.UserID, registered.UserID)
+	}
+
+	var verified bool
+	if err := s.db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", registered.UserID).Scan(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("linking by a verified address did not mark the email verified")
+	}
+}
+
+func TestSSOLoginRejectsUnverifiedEmailOfExistingAccount(t *testing.T) {
+	s, idp := newSSOTestService(t)
+
+	email := uniqueName("taken") + "@example.com"
+	if _, err := s.Register(context.Background(), models.AuthRequest{Username: uniqueName("local"), Email: email, Password: testPassword}, models.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ssoLogin(s, idp, oidctest.Identity{Subject: uniqueName("sub"), Email: email, EmailVerified: false})
+	if !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("got error %v, want ErrIdentityConflict", err)
+	}
+}
+
+func TestSSOLoginDoesNotLinkProtectedAccounts(t *testing.T) {
+	s, idp := newSSOTestService(t)
+	ctx := context.Background()
+
+	for name, protect := range map[string]string{
+		"admin":      "UPDATE users SET role = 'admin' WHERE id = $1",
+		"two-factor": "INSERT INTO user_totp (user_id, secret_encrypted, enabled_at) VALUES ($1, 'secret', NOW())",
+	} {
+		email := uniqueName("protected") + "@example.com"
+		registered, err := s.Register(ctx, models.AuthRequest{Username: uniqueName("local"), Email: email, Password: testPassword}, models.ClientInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(protect, registered.UserID); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ssoLogin(s, idp, oidctest.Identity{Subject: uniqueName("sub"), Email: email, EmailVerified: true})
+		if !errors.Is(err, ErrIdentityConflict) {
+			t.Errorf("%s: got error %v, want ErrIdentityConflict", name, err)
+		}
+	}
+}
+
+func TestSSOLoginChecksState(t *testing.T) {
+	s, idp := newSSOTestService(t)
+	ctx := context.Background()
+	identity := oidctest.Identity{Subject: uniqueName("sub"), Email: uniqueName("state") + "@example.com", EmailVerified: true}
+
+	authURL, binding, err := s.StartSSOLogin(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Login(authURL, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := models.SSOCallbackRequest{Code: code, State: state}
+	if _, err := s.CompleteSSOLogin(ctx, "test", models.SSOCallbackRequest{Code: code, State: "forged"}, binding, models.ClientInfo{}); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("forged state: got error %v, want ErrInvalidSSOState", err)
+	}
+	// A callback link handed to another browser, which lacks the binding
+	if _, err := s.CompleteSSOLogin(ctx, "test", callback, "", models.ClientInfo{}); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("other browser: got error %v, want ErrInvalidSSOState", err)
+	}
+	if _, err := s.CompleteSSOLogin(ctx, "other", callback, binding, models.ClientInfo{}); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("other provider: got error %v, want ErrUnknownProvider", err)
+	}
+	if _, err := s.CompleteSSOLogin(ctx, "test", callback, binding, models.ClientInfo{}); err != nil {
+		t.Fatalf("valid state: %v", err)
+	}
+	if _, err := s.CompleteSSOLogin(ctx, "test", callback, binding, models.ClientInfo{}); !errors.Is(err, ErrInvalidSSOState) {
+		t.Fatalf("reused state: got error %v, want ErrInvalidSSOState", err)
+	}
+}
+
+func TestSSOLoginRejectsInvalidIDToken(t *testing.T) {
+	s, idp := newSSOTestService(t)
+
+	for name, identity := range map[string]oidctest.Identity{
+		"wrong issuer":   {Subject: uniqueName("sub"), Issuer: "https://evil.example.com"},
+		"wrong audience": {Subject: uniqueName("sub"), Audience: "other-client"},
+		"bad signature":  {Subject: uniqueName("sub"), ForeignKey: true},
+		"wrong nonce":    {Subject: uniqueName("sub"), Nonce: "replayed"},
+	} {
+		if _, err := ssoLogin(s, idp, identity); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("%s: got error %v, want ErrInvalidIDToken", name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// internal/service/tickets.go
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// ErrInvalidTicket is returned for unknown, expired or already used connection tickets, and
+// for tickets whose token has since expired or been revoked
+var ErrInvalidTicket = errors.New("invalid connection ticket")
+
+// IssueConnectionTicket issues a single-use ticket that stands in for the caller's access
+// token when opening a WebSocket connection
+func (s *AuthService) IssueConnectionTicket(ctx context.Context, claims *auth.Claims) (*models.ConnectionTicket, error) {
+	ticket, ticketHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tickets are used within seconds; drop the ones that never were
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM connection_tickets WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Error pruning connection tickets: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO connection_tickets (ticket_hash, user_id, claims, expires_at) VALUES ($1, $2, $3, $4)",
+		ticketHash, claims.UserID, string(encoded), time.Now().Add(s.config.ConnectionTicketExpiration))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ConnectionTicket{
+		Ticket:    ticket,
+		ExpiresIn: int64(s.config.ConnectionTicketExpiration / time.Second),
+	}, nil
+}
+
+// RedeemConnectionTicket uses up a ticket and returns the claims of the token it was issued
+// for, along with the caller's access to the room being joined. The token itself is never
+// handed out, so a ticket is worth no more than the one connection.
+func (s *AuthService) RedeemConnectionTicket(ctx context.Context, ticket, roomID string) (*models.RedeemedTicket, error) {
+	var encoded string
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx,
+		"DELETE FROM connection_tickets WHERE ticket_hash = $1 RETURNING claims, expires_at",
+		hashToken(ticket)).Scan(&encoded, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var claims auth.Claims
+	if err := json.Unmarshal([]byte(encoded), &claims); err != nil {
+		return nil, err
+	}
+
+	// The token may have expired or been revoked since the ticket was issued
+	if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
+		return nil, ErrInvalidTicket
+	}
+	revoked, err := s.IsTokenRevoked(ctx, &claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidTicket
+	}
+
+	access, err := s.RoomAccess(ctx, roomID, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RedeemedTicket{Claims: &claims, Access: access}, nil
+}
@@ -0,0 +1,194 @@
+// internal/service/tokens.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired, revoked or reused refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// newOpaqueToken returns a random URL-safe token and the hash under which it is stored
+func newOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken hashes an opaque token for storage; tokens carry 256 bits of entropy so a plain
+// SHA-256 is sufficient
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens starts a new login session for a user on the client and issues an access
+// token and a refresh token for it
+func (s *AuthService) issueTokens(ctx context.Context, userID, username string, client models.ClientInfo) (*models.AuthResponse, error) {
+	sessionID := uuid.New().String()
+	_, err := s.db.ExecContext(ctx, `
+	INSERT INTO sessions (id, user_id, device_name, user_agent, ip_address, created_at, last_used_at)
+	VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+	`, sessionID, userID, clip(client.DeviceName, maxDeviceNameLength), clip(client.UserAgent, maxUserAgentLength), client.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokensTx(ctx, s.db, userID, username, sessionID)
+}
+
+// login starts a session for a user who authenticated with method and records the login
+func (s *AuthService) login(ctx context.Context, userID, username, method string, client models.ClientInfo) (*models.AuthResponse, error) {
+	resp, err := s.issueTokens(ctx, userID, username, client)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, models.AuditEvent{
+		Action:    models.AuditLoginSucceeded,
+		ActorID:   userID,
+		IPAddress: client.IPAddress,
+		Details:   map[string]string{"method": method, "session_id": resp.SessionID},
+	})
+	return resp, nil
+}
+
+// execer is the subset of *sql.DB and *sql.Tx used to issue tokens
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// issueTokensTx issues an access token and a refresh token for an existing session, storing
+// the refresh token through db. The session ID doubles as the refresh token family.
+func (s *AuthService) issueTokensTx(ctx context.Context, db execer, userID, username, familyID string) (*models.AuthResponse, error) {
+	refreshToken, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		uuid.New().String(), familyID, userID, refreshHash, time.Now().Add(s.config.RefreshTokenExpiration), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// The user's global role is carried in the token for other services
+	var role string
+	if err := db.QueryRowContext(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role); err != nil {
+		return nil, err
+	}
+
+	// Generate a JWT token
+	token, err := s.jwtMiddleware.GenerateToken(userID, username, familyID, []string{role}, s.config.JWTExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        token,
+		ExpiresIn:    int64(s.config.JWTExpiration / time.Second),
+		RefreshToken: refreshToken,
+		Username:     username,
+		UserID:       userID,
+		SessionID:    familyID,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once; presenting one that was already rotated means it
+// has leaked, so the whole family is revoked and the user has to log in again.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client models.ClientInfo) (*models.AuthResponse, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID, familyID, userID, username string
+		expiresAt                           time.Time
+		rotatedAt, revokedAt                sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `
+	SELECT t.id, t.family_id, t.user_id, u.username, t.expires_at, t.rotated_at, t.revoked_at
+	FROM refresh_tokens t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1
+	FOR UPDATE OF t
+	`, hashToken(refreshToken)).Scan(&tokenID, &familyID, &userID, &username, &expiresAt, &rotatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if rotatedAt.Valid {
+		// Whoever reused the token may hold access tokens of the session too, so the whole
+		// session is revoked, not just its refresh tokens
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyID); err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, created_at, last_used_at, revoked_at)
+		VALUES ($1, $2, $3, $3, $3)
+		ON CONFLICT (id) DO UPDATE SET revoked_at = COALESCE(sessions.revoked_at, EXCLUDED.revoked_at)
+		`, familyID, userID, now)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		log.Printf("Refresh token reuse detected for user %s, revoked session %s", userID, familyID)
+		if err := s.sessionRevoked(ctx, userID, familyID, userID, now, "refresh_token_reuse"); err != nil {
+			log.Printf("Error publishing revocation of session %s: %v", familyID, err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1", tokenID); err != nil {
+		return nil, err
+	}
+
+	// Families from before sessions were recorded get a session on their first refresh
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_used_at)
+	VALUES ($1, $2, $3, $4, NOW(), NOW())
+	ON CONFLICT (id) DO UPDATE SET user_agent = EXCLUDED.user_agent, ip_address = EXCLUDED.ip_address, last_used_at = NOW()
+	`, familyID, userID, clip(client.UserAgent, maxUserAgentLength), client.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.issueTokensTx(ctx, tx, userID, username, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
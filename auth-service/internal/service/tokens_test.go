@@ -0,0 +1,83 @@
+// internal/service/tokens_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+)
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	s, publisher := newTestService(t, nil, nil)
+	ctx := context.Background()
+
+	registered, err := s.Register(ctx, models.AuthRequest{
+		Username: uniqueName("reuse"),
+		Email:    uniqueName("reuse") + "@example.com",
+		Password: testPassword,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.jwtMiddleware.Verifier.Verify(registered.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(ctx, registered.RefreshToken, models.ClientInfo{}); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if _, err := s.Refresh(ctx, registered.RefreshToken, models.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reused refresh token: got error %v, want ErrInvalidRefreshToken", err)
+	}
+
+	revoked, err := s.IsTokenRevoked(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("access token of the session is still valid after refresh token reuse")
+	}
+
+	published := false
+	publisher.mu.Lock()
+	for _, event := range publisher.userEvents {
+		published = published || (event.EventType == models.EventSessionRevoked && event.SessionID == registered.SessionID)
+	}
+	publisher.mu.Unlock()
+	if !published {
+		t.Errorf("no %s event for session %s", models.EventSessionRevoked, registered.SessionID)
+	}
+}
+
+func TestRevokeUserTokensWithinTheSecond(t *testing.T) {
+	s, _ := newTestService(t, nil, nil)
+	ctx := context.Background()
+
+	registered, err := s.Register(ctx, models.AuthRequest{
+		Username: uniqueName("revoked"),
+		Email:    uniqueName("revoked") + "@example.com",
+		Password: testPassword,
+	}, models.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.jwtMiddleware.Verifier.Verify(registered.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The token was most likely issued within the same second as the revocation
+	if err := s.RevokeUserTokens(ctx, registered.UserID, registered.UserID); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := s.IsTokenRevoked(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("token issued before the revocation is still valid")
+	}
+}
@@ -0,0 +1,350 @@
+// internal/service/twofactor.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	models "github.com/afzalabbasi/message-service/auth-service/internal/model"
+	"github.com/afzalabbasi/message-service/auth-service/internal/totp"
+)
+
+// Number of recovery codes issued at a time
+const recoveryCodeCount = 10
+
+var (
+	// ErrTwoFactorUnavailable is returned when no key to encrypt TOTP secrets is configured
+	ErrTwoFactorUnavailable = errors.New("two-factor authentication is not available")
+
+	// ErrTwoFactorNotEnrolled is returned when the user has not started or finished enrollment
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enabled")
+
+	// ErrTwoFactorEnabled is returned when enrolling a user who already uses two-factor authentication
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+	// ErrInvalidTwoFactorCode is returned for wrong, reused or missing codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+	// ErrInvalidChallenge is returned for invalid or expired two-factor challenge tokens
+	ErrInvalidChallenge = errors.New("invalid or expired challenge")
+)
+
+// EnrollTwoFactor creates a new TOTP secret for a user. It takes effect once confirmed
+// with a code from the authenticator app; enrolling again replaces an unconfirmed secret.
+func (s *AuthService) EnrollTwoFactor(ctx context.Context, userID string) (*models.TwoFactorEnrollment, error) {
+	if s.cipher == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+
+	var username string
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, `
+	SELECT u.username, t.enabled_at IS NOT NULL
+	FROM users u LEFT JOIN user_totp t ON t.user_id = u.id
+	WHERE u.id = $1
+	`, userID).Scan(&username, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.cipher.Encrypt(secret, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+	INSERT INTO user_totp (user_id, secret_encrypted, created_at) VALUES ($1, $2, NOW())
+	ON CONFLICT (user_id) DO UPDATE SET secret_encrypted = EXCLUDED.secret_encrypted, created_at = NOW()
+	WHERE user_totp.enabled_at IS NULL
+	`, userID, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.config.TOTPIssuer, username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves their app
+// produces valid codes, and returns their recovery codes
+func (s *AuthService) ConfirmTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT enabled_at IS NOT NULL FROM user_totp WHERE user_id = $1 FOR UPDATE", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if err := s.useTOTPCode(ctx, tx, userID, code); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET enabled_at = NOW() WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, models.AuditEvent{Action: models.AuditTwoFactorEnabled, ActorID: userID})
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes; a current code is required
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkSecondFactor(ctx, tx, userID, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking the user's password
+// and second factor
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID string, req models.DisableTwoFactorRequest) error {
+	var passwordHash string
+	err := s.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// Wrong passwords and codes count as failed logins, as in Login
+	if err := s.limiter.CheckAccount(ctx, userID); err != nil {
+		return err
+	}
+	if match, _ := s.verifyPassword(userID, req.Password, passwordHash); !match {
+		return s.loginFailed(ctx, userID, userID, "", ErrWrongPassword)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = s.checkSecondFactor(ctx, tx, userID, req.Code, req.RecoveryCode)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return s.loginFailed(ctx, userID, userID, "", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.audit(ctx, models.AuditEvent{Action: models.AuditTwoFactorDisabled, ActorID: userID})
+	return nil
+}
+
+// CompleteTwoFactorLogin finishes a login started by Login with a code or recovery code.
+// Wrong codes count as failed logins of the account, and attempts count towards the
+// client's IP limit like password attempts do.
+func (s *AuthService) CompleteTwoFactorLogin(ctx context.Context, req models.TwoFactorLoginRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	if err := s.limiter.CheckIP(ctx, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	claims, err := s.jwtMiddleware.ValidateChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.limiter.CheckAccount(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = s.checkSecondFactor(ctx, tx, claims.UserID, req.Code, req.RecoveryCode)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return nil, s.loginFailed(ctx, claims.UserID, claims.UserID, client.IPAddress, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := s.limiter.Success(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	// The username may have changed since the challenge was issued
+	var username string
+	if err := s.db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = $1", claims.UserID).Scan(&username); err != nil {
+		return nil, err
+	}
+
+	return s.login(ctx, claims.UserID, username, "two_factor", client)
+}
+
+// twoFactorEnabled reports whether a user has confirmed two-factor authentication
+func (s *AuthService) twoFactorEnabled(ctx context.Context, userID string) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// checkSecondFactor consumes a TOTP code, or a recovery code if no code is given, of a
+// user with two-factor authentication enabled
+func (s *AuthService) checkSecondFactor(ctx context.Context, tx *sql.Tx, userID, code, recoveryCode string) error {
+	var enabled bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT enabled_at IS NOT NULL FROM user_totp WHERE user_id = $1 FOR UPDATE", userID).Scan(&enabled)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	if code != "" {
+		return s.useTOTPCode(ctx, tx, userID, code)
+	}
+	if recoveryCode == "" {
+		return ErrInvalidTwoFactorCode
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE totp_recovery_codes SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// useTOTPCode checks a code against the user's secret. Each code is accepted once: the
+// time step of the last accepted code is stored and older or equal steps are rejected.
+func (s *AuthService) useTOTPCode(ctx context.Context, tx *sql.Tx, userID, code string) error {
+	if s.cipher == nil {
+		return ErrTwoFactorUnavailable
+	}
+
+	var encrypted string
+	var lastStep sql.NullInt64
+	err := tx.QueryRowContext(ctx,
+		"SELECT secret_encrypted, last_used_step FROM user_totp WHERE user_id = $1", userID).Scan(&encrypted, &lastStep)
+	if err == sql.ErrNoRows {
+		return ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	secret, err := s.cipher.Decrypt(encrypted, userID)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now())
+	if !ok || (lastStep.Valid && step <= lastStep.Int64) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2", step, userID)
+	return err
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and returns new ones; only their
+// hashes are stored
+func (s *AuthService) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+		codes[i] = code[:5] + "-" + code[5:10]
+
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO totp_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, NOW())",
+			userID, hashToken(normalizeRecoveryCode(codes[i]))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes in typed recovery codes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,125 @@
+// internal/validation/password.go
+package validation
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxPasswordBytes is the most bcrypt hashes; anything after it would be silently ignored
+const MaxPasswordBytes = 72
+
+// PasswordPolicy decides which passwords users may choose
+type PasswordPolicy struct {
+	// Fewest characters a password may have
+	MinLength int
+
+	// Fewest character classes (lower case, upper case, digits, everything else) a
+	// password has to mix
+	MinClasses int
+
+	// SHA-1 hashes of passwords known from breaches; nil if not checked
+	breached map[[sha1.Size]byte]struct{}
+}
+
+// NewPasswordPolicy creates a password policy. If breachedFile is set, passwords whose
+// SHA-1 hash is listed in it are rejected.
+func NewPasswordPolicy(minLength, minClasses int, breachedFile string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		MinLength:  minLength,
+		MinClasses: minClasses,
+	}
+	if breachedFile != "" {
+		breached, err := loadBreachedHashes(breachedFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = breached
+	}
+	return p, nil
+}
+
+// Check checks a new password against the policy
+func (p *PasswordPolicy) Check(field, password string) *FieldError {
+	switch {
+	case password == "":
+		return fieldError(field, CodeRequired, "Password is required")
+	case len(password) > MaxPasswordBytes:
+		return fieldError(field, CodeTooLong, "Password must be at most "+strconv.Itoa(MaxPasswordBytes)+" bytes")
+	case len([]rune(password)) < p.MinLength:
+		return fieldError(field, CodeTooShort, "Password must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	case characterClasses(password) < p.MinClasses:
+		return fieldError(field, CodeTooWeak, "Password must mix at least "+strconv.Itoa(p.MinClasses)+
+			" of lower case letters, upper case letters, digits and symbols")
+	case p.isBreached(password):
+		return fieldError(field, CodeBreached, "Password has appeared in a data breach, choose another one")
+	}
+	return nil
+}
+
+// isBreached reports whether the password is on the breached password list
+func (p *PasswordPolicy) isBreached(password string) bool {
+	if p.breached == nil {
+		return false
+	}
+	_, ok := p.breached[sha1.Sum([]byte(password))]
+	return ok
+}
+
+// characterClasses counts the character classes password mixes
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// loadBreachedHashes reads a list of hex encoded SHA-1 password hashes, one per line. Lines
+// may carry a ":count" suffix, as in the Pwned Passwords downloads; blank lines and lines
+// starting with '#' are skipped.
+func loadBreachedHashes(path string) (map[[sha1.Size]byte]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text, _, _ = strings.Cut(text, ":")
+
+		var hash [sha1.Size]byte
+		if len(text) != hex.EncodedLen(sha1.Size) {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+		if _, err := hex.Decode(hash[:], []byte(text)); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+		hashes[hash] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
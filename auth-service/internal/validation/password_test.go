@@ -0,0 +1,128 @@
+// internal/validation/password_test.go
+package validation
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBreachedFile writes a breached password list to a temporary file and returns its path
+func writeBreachedFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sha1Hex returns the upper case hex SHA-1 of password, as the Pwned Passwords downloads list it
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	p, err := NewPasswordPolicy(8, 3, writeBreachedFile(t, sha1Hex("Password123")+":52"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode string
+	}{
+		{"three classes", "horse-battery-9", ""},
+		{"four classes", "Horse-battery-9", ""},
+		{"shortest", "abcDEF12", ""},
+		{"longest", strings.Repeat("aB3", 24), ""},
+		{"empty", "", CodeRequired},
+		{"too short", "aB3-", CodeTooShort},
+		{"one byte too long", strings.Repeat("aB3", 24) + "x", CodeTooLong},
+		// 38 characters, but 74 bytes: bcrypt would ignore the tail
+		{"multibyte over the byte limit", strings.Repeat("ü", 36) + "A1", CodeTooLong},
+		{"multibyte counted in characters", "äöüÄÖÜ12", ""},
+		{"only lower case", "horsebattery", CodeTooWeak},
+		{"lower case and digits", "horsebattery9", CodeTooWeak},
+		{"breached", "Password123", CodeBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check("password", tt.password)
+			if got := code(err); got != tt.wantCode {
+				t.Fatalf("got code %q (%v), want %q", got, err, tt.wantCode)
+			}
+			if err != nil && err.Field != "password" {
+				t.Errorf("error names field %q, want %q", err.Field, "password")
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyWithoutBreachedList(t *testing.T) {
+	p, err := NewPasswordPolicy(8, 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check("password", "Password123"); err != nil {
+		t.Errorf("got %v, want no error without a breached list", err)
+	}
+}
+
+func TestLoadBreachedHashes(t *testing.T) {
+	path := writeBreachedFile(t,
+		"# Pwned Passwords sample",
+		"",
+		sha1Hex("Password123")+":52",
+		strings.ToLower(sha1Hex("letmein")),
+		"  "+sha1Hex("qwerty")+":3  ",
+	)
+
+	hashes, err := loadBreachedHashes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Errorf("got %d hashes, want 3", len(hashes))
+	}
+	for _, password := range []string{"Password123", "letmein", "qwerty"} {
+		if _, ok := hashes[sha1.Sum([]byte(password))]; !ok {
+			t.Errorf("hash of %q not loaded", password)
+		}
+	}
+}
+
+func TestLoadBreachedHashesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"too short", sha1Hex("letmein")[:39]},
+		{"too long", sha1Hex("letmein") + "0"},
+		{"not hex", "Z" + sha1Hex("letmein")[1:]},
+		{"count only", ":52"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeBreachedFile(t, "# header", sha1Hex("qwerty"), tt.line)
+			_, err := loadBreachedHashes(path)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if want := path + ":3:"; !strings.HasPrefix(err.Error(), want) {
+				t.Errorf("error %q does not name the line as %q", err, want)
+			}
+		})
+	}
+
+	if _, err := NewPasswordPolicy(8, 3, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing breached list: got no error")
+	}
+}
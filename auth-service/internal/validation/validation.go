@@ -0,0 +1,162 @@
+// internal/validation/validation.go
+package validation
+
+import (
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+)
+
+// Field error codes, stable across releases so clients can show their own messages
+const (
+	CodeRequired = "required"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeInvalid  = "invalid"
+	CodeTooWeak  = "too_weak"
+	CodeBreached = "breached"
+)
+
+// Limits of the users table's columns
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 50
+	MaxEmailLength    = 100
+	MaxDisplayName    = 100
+	MaxAvatarURL      = 500
+)
+
+// FieldError describes why the value of a single field was rejected; it is sent to
+// clients as is in the fields of a validation_failed error
+type FieldError = apierror.FieldError
+
+// Errors lists every invalid field of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Add records an invalid field; nil errors are ignored so checks can be added unconditionally
+func (e *Errors) Add(err *FieldError) {
+	if err != nil {
+		*e = append(*e, *err)
+	}
+}
+
+// Err returns e as an error, or nil if no field is invalid
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Username checks a username: 3 to 50 ASCII letters, digits, '_', '.' or '-', starting
+// with a letter or digit
+func Username(field, username string) *FieldError {
+	switch {
+	case username == "":
+		return fieldError(field, CodeRequired, "Username is required")
+	case len(username) < MinUsernameLength:
+		return fieldError(field, CodeTooShort, "Username must be at least 3 characters")
+	case len(username) > MaxUsernameLength:
+		return fieldError(field, CodeTooLong, "Username must be at most 50 characters")
+	case !isAlnum(username[0]):
+		return fieldError(field, CodeInvalid, "Username must start with a letter or digit")
+	}
+	for i := 0; i < len(username); i++ {
+		if c := username[i]; !isAlnum(c) && c != '_' && c != '.' && c != '-' {
+			return fieldError(field, CodeInvalid, "Username may only contain letters, digits, '_', '.' and '-'")
+		}
+	}
+	return nil
+}
+
+// SanitizeUsername turns a name from elsewhere, such as an identity provider, into a valid
+// username by dropping the characters usernames may not contain. It returns fallback if
+// too little is left.
+func SanitizeUsername(name, fallback string) string {
+	var b strings.Builder
+	for i := 0; i < len(name) && b.Len() < MaxUsernameLength; i++ {
+		c := name[i]
+		if isAlnum(c) || (b.Len() > 0 && (c == '_' || c == '.' || c == '-')) {
+			b.WriteByte(c)
+		}
+	}
+	if b.Len() < MinUsernameLength {
+		return fallback
+	}
+	return b.String()
+}
+
+// NormalizeEmail checks an email address and returns its canonical form: trimmed and case
+// folded, so the same mailbox is never registered twice with different capitalization.
+// Display names ("Jane <jane@example.com>") are rejected.
+func NormalizeEmail(field, email string) (string, *FieldError) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", fieldError(field, CodeRequired, "Email is required")
+	}
+	if len(email) > MaxEmailLength {
+		return "", fieldError(field, CodeTooLong, "Email must be at most 100 characters")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", fieldError(field, CodeInvalid, "Invalid email address")
+	}
+	local, domain, _ := strings.Cut(addr.Address, "@")
+	if local == "" || !strings.Contains(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fieldError(field, CodeInvalid, "Invalid email address")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// CanonicalEmail case folds an email address for lookups without validating it, so a
+// malformed address in a login or reset request simply matches no account
+func CanonicalEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// DisplayName checks a display name; empty clears it
+func DisplayName(field, name string) *FieldError {
+	if utf8.RuneCountInString(name) > MaxDisplayName {
+		return fieldError(field, CodeTooLong, "Display name must be at most 100 characters")
+	}
+	if !utf8.ValidString(name) {
+		return fieldError(field, CodeInvalid, "Display name must be valid UTF-8")
+	}
+	return nil
+}
+
+// AvatarURL checks an avatar URL; empty clears it
+func AvatarURL(field, avatarURL string) *FieldError {
+	if avatarURL == "" {
+		return nil
+	}
+	if len(avatarURL) > MaxAvatarURL {
+		return fieldError(field, CodeTooLong, "Avatar URL must be at most 500 characters")
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fieldError(field, CodeInvalid, "Avatar URL must be an http or https URL")
+	}
+	return nil
+}
+
+// fieldError creates a FieldError
+func fieldError(field, code, message string) *FieldError {
+	return &FieldError{Field: field, Code: code, Message: message}
+}
+
+// isAlnum reports whether c is an ASCII letter or digit
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
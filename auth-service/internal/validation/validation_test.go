@@ -0,0 +1,116 @@
+// internal/validation/validation_test.go
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+// code returns the code of a field error, or "" for none
+func code(err *FieldError) string {
+	if err == nil {
+		return ""
+	}
+	return err.Code
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		want     string
+		wantCode string
+	}{
+		{"plain", "jane@example.com", "jane@example.com", ""},
+		{"case folded", "Jane.Doe@Example.COM", "jane.doe@example.com", ""},
+		{"surrounding space", "  jane@example.com\t", "jane@example.com", ""},
+		{"subdomain", "jane@mail.example.co.uk", "jane@mail.example.co.uk", ""},
+		{"empty", "", "", CodeRequired},
+		{"blank", "   ", "", CodeRequired},
+		{"too long", strings.Repeat("a", MaxEmailLength) + "@example.com", "", CodeTooLong},
+		{"display name", "Jane <jane@example.com>", "", CodeInvalid},
+		{"quoted display name", `"Jane Doe" <jane@example.com>`, "", CodeInvalid},
+		{"angle brackets only", "<jane@example.com>", "", CodeInvalid},
+		{"no at sign", "jane.example.com", "", CodeInvalid},
+		{"no local part", "@example.com", "", CodeInvalid},
+		{"no dot in domain", "jane@localhost", "", CodeInvalid},
+		{"trailing dot in domain", "jane@example.com.", "", CodeInvalid},
+		{"two addresses", "jane@example.com, joe@example.com", "", CodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail("email", tt.email)
+			if code(err) != tt.wantCode {
+				t.Fatalf("got error %v, want code %q", err, tt.wantCode)
+			}
+			if err != nil && err.Field != "email" {
+				t.Errorf("error names field %q, want %q", err.Field, "email")
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	if got := CanonicalEmail("  Jane@Example.com "); got != "jane@example.com" {
+		t.Errorf("got %q, want %q", got, "jane@example.com")
+	}
+}
+
+func TestUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		wantCode string
+	}{
+		{"letters", "jane", ""},
+		{"mixed case and digits", "Jane2024", ""},
+		{"punctuation", "jane.doe_99-x", ""},
+		{"starts with digit", "9lives", ""},
+		{"shortest", "abc", ""},
+		{"longest", strings.Repeat("a", MaxUsernameLength), ""},
+		{"empty", "", CodeRequired},
+		{"too short", "ab", CodeTooShort},
+		{"too long", strings.Repeat("a", MaxUsernameLength+1), CodeTooLong},
+		{"starts with dot", ".jane", CodeInvalid},
+		{"starts with underscore", "_jane", CodeInvalid},
+		{"space", "jane doe", CodeInvalid},
+		{"at sign", "jane@home", CodeInvalid},
+		{"non-ASCII letter", "jöhn", CodeInvalid},
+		{"slash", "jane/doe", CodeInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := code(Username("username", tt.username)); got != tt.wantCode {
+				t.Errorf("Username(%q): got code %q, want %q", tt.username, got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Jane Doe", "JaneDoe"},
+		{"jane.doe@example.com", "jane.doeexample.com"},
+		{"__jane", "jane"},
+		{"李", "fallback"},
+		{strings.Repeat("a", MaxUsernameLength+10), strings.Repeat("a", MaxUsernameLength)},
+	}
+
+	for _, tt := range tests {
+		got := SanitizeUsername(tt.name, "fallback")
+		if got != tt.want {
+			t.Errorf("SanitizeUsername(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if err := Username("username", got); err != nil {
+			t.Errorf("SanitizeUsername(%q) = %q, which is not a valid username: %v", tt.name, got, err)
+		}
+	}
+}
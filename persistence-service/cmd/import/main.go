@@ -0,0 +1,56 @@
+// cmd/import/main.go
+
+// Command import bulk-loads a room export (NDJSON or zip, see internal/export) into the
+// messages table, preserving message IDs and timestamps.
+//
+//	go run ./cmd/import -file room-1234.zip [-room new-room-id]
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/export"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+	"log"
+	"os"
+)
+
+func main() {
+	file := flag.String("file", "", "path to the export to import")
+	room := flag.String("room", "", "import into this room ID instead of the one in the export")
+	postgresURL := flag.String("postgres", os.Getenv("POSTGRES_URL"), "PostgreSQL connection URL")
+	flag.Parse()
+
+	if *file == "" || *postgresURL == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := repository.NewRepository(&config.Config{PostgresURL: *postgresURL})
+	if err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+	defer repo.Close()
+
+	var meta *export.Metadata
+	imported, err := repo.ImportMessages(context.Background(), func(save func(models.Message) error) error {
+		var err error
+		meta, err = export.ReadFile(*file, func(msg models.Message) error {
+			if *room != "" {
+				msg.RoomID = *room
+			}
+			return save(msg)
+		})
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Import failed, nothing was imported: %v", err)
+	}
+
+	if meta != nil {
+		log.Printf("Export of room %s taken at %s holds %d messages", meta.RoomID, meta.ExportedAt, meta.MessageCount)
+	}
+	log.Printf("Imported %d new messages", imported)
+}
@@ -3,13 +3,19 @@ package main
 
 import (
 	"context"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/api"
 	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
 	"github.com/afzalabbasi/message-service/persistence-service/internal/kafka"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/maintenance"
 	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -33,6 +39,18 @@ func main() {
 	}
 	defer consumer.Close()
 
+	userEventConsumer, err := kafka.NewUserEventConsumer(cfg, repo)
+	if err != nil {
+		log.Fatalf("Failed to create user event consumer: %v", err)
+	}
+	defer userEventConsumer.Close()
+
+	auditEventConsumer, err := kafka.NewAuditEventConsumer(cfg, repo)
+	if err != nil {
+		log.Fatalf("Failed to create audit event consumer: %v", err)
+	}
+	defer auditEventConsumer.Close()
+
 	// Create a context that is canceled when the program is interrupted
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -44,6 +62,60 @@ func main() {
 		}
 	}()
 
+	// Apply account deletions and other user events in a goroutine
+	go func() {
+		if err := userEventConsumer.Consume(ctx); err != nil {
+			log.Fatalf("Failed to consume user events: %v", err)
+		}
+	}()
+
+	// Record the other services' audit events in a goroutine
+	go func() {
+		if err := auditEventConsumer.Consume(ctx); err != nil {
+			log.Fatalf("Failed to consume audit events: %v", err)
+		}
+	}()
+
+	// Keep partitions ahead of incoming messages and enforce retention in the background
+	go maintenance.NewRunner(repo, cfg).Run(ctx)
+
+	// Verify tokens with the auth service's published keys; unknown keys are fetched on demand
+	keys := auth.NewJWKSCache(cfg.AuthServiceURL)
+	keysCtx, keysCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := keys.Refresh(keysCtx); err != nil {
+		log.Printf("Failed to fetch token verification keys: %v", err)
+	}
+	keysCancel()
+	verifier := auth.NewVerifier(auth.VerifierConfig{
+		Keys:     keys.Keyfunc,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Leeway:   cfg.JWTLeeway,
+	})
+
+	// Room roles are resolved with the auth service
+	authorizer := authz.NewAuthorizer(cfg.AuthServiceURL)
+
+	// Initialize HTTP handler
+	handler := api.NewHandler(repo, cfg, verifier, authorizer)
+
+	// Configure server
+	server := &http.Server{
+		Addr:         cfg.ServerAddress,
+		Handler:      handler.SetupRoutes(),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Start server in a goroutine
+	go func() {
+		log.Printf("Starting persistence API on %s", cfg.ServerAddress)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
 	log.Println("Persistence service started...")
 
 	// Wait for interrupt signal to gracefully shut down the service
@@ -52,6 +124,14 @@ func main() {
 	<-quit
 	log.Println("Shutting down service...")
 
+	// Create a deadline to wait for current requests to complete
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
 	// Cancel the context to signal to the consumer to stop
 	cancel()
 	log.Println("Service exiting")
@@ -3,11 +3,17 @@ module github.com/afzalabbasi/message-service/persistence-service
 go 1.24.2
 
 require (
+	github.com/go-chi/chi/v5 v5.2.1
 	github.com/lib/pq v1.10.9
 	github.com/segmentio/kafka-go v0.4.47
 )
 
+require github.com/golang-jwt/jwt/v4 v4.5.2 // indirect
+
 require (
+	github.com/afzalabbasi/message-service/pkg v0.0.0
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 )
+
+replace github.com/afzalabbasi/message-service/pkg => ../pkg
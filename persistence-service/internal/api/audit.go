@@ -0,0 +1,104 @@
+// internal/api/audit.go
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+)
+
+const (
+	// Default and maximum number of audit records returned per page
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// requireAdmin middleware rejects callers that are not admins. Service clients cannot use
+// the admin routes.
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.FromContext(r.Context())
+		if !ok || claims.Bot || !claims.HasRole(authz.RoleAdmin) {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditLog lists audit records, newest first, filtered by actor, action and time range
+func (h *Handler) auditLog(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := models.AuditQuery{
+		ActorID: params.Get("actor_id"),
+		Action:  params.Get("action"),
+		Limit:   defaultAuditLimit,
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'from' timestamp, expected RFC 3339")
+		return
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'to' timestamp, expected RFC 3339")
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		if q.Limit > maxAuditLimit {
+			q.Limit = maxAuditLimit
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid offset")
+			return
+		}
+	}
+
+	records, err := h.repo.QueryAuditLog(r.Context(), q)
+	if err != nil {
+		log.Printf("Error querying audit log: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to query audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": records,
+		"limit":  q.Limit,
+		"offset": q.Offset,
+	})
+}
+
+// verifyAuditLog checks the audit log's hash chain for altered or removed records
+func (h *Handler) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	// The whole log is read, which can take longer than the server's write timeout allows
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not lift write deadline for audit log verification: %v", err)
+	}
+
+	result, err := h.repo.VerifyAuditLog(r.Context())
+	if err != nil {
+		log.Printf("Error verifying audit log: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify audit log")
+		return
+	}
+	if !result.Valid {
+		log.Printf("Audit log hash chain broken at record %d", *result.BrokenAt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,366 @@
+// internal/api/handler.go
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/export"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/afzalabbasi/message-service/pkg/realip"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// Default number of search results returned per page
+	defaultSearchLimit = 20
+
+	// Maximum number of search results returned per page
+	maxSearchLimit = 100
+
+	// Maximum number of rooms with matches whose access is checked for a search; searches
+	// matching in more rooms cover the most recently active ones and say so in the response
+	maxSearchRooms = 1000
+
+	// Default and maximum number of history messages returned per page
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// Handler handles HTTP requests for the persistence service
+type Handler struct {
+	repo   *repository.Repository
+	config *config.Config
+	// Verifies the access tokens of protected routes
+	verifier *auth.Verifier
+	// Resolves callers' room roles
+	authorizer *authz.Authorizer
+}
+
+// NewHandler creates a new Handler
+func NewHandler(repo *repository.Repository, cfg *config.Config, verifier *auth.Verifier, authorizer *authz.Authorizer) *Handler {
+	return &Handler{
+		repo:       repo,
+		config:     cfg,
+		verifier:   verifier,
+		authorizer: authorizer,
+	}
+}
+
+// SetupRoutes sets up the routes for the persistence service
+func (h *Handler) SetupRoutes() http.Handler {
+	r := chi.NewRouter()
+
+	// Middleware
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.RequestID)
+	r.Use(realip.Middleware(h.config.TrustedProxies))
+	r.NotFound(apierror.NotFound)
+	r.MethodNotAllowed(apierror.MethodNotAllowed)
+
+	// Routes
+	r.Get("/health", h.healthCheck)
+
+	// Protected routes
+	r.Group(func(r chi.Router) {
+		r.Use(h.verifier.Middleware)
+		r.Use(auth.RequireScope(auth.ScopeMessagesRead))
+		r.Get("/search", h.search)
+		r.Get("/rooms/{roomID}/messages", h.roomHistory)
+		r.Get("/rooms/{roomID}/export", h.exportRoom)
+	})
+
+	// Admin routes
+	r.Group(func(r chi.Router) {
+		r.Use(h.verifier.Middleware)
+		r.Use(h.requireAdmin)
+		r.Get("/admin/audit", h.auditLog)
+		r.Get("/admin/audit/verify", h.verifyAuditLog)
+		r.Get("/admin/retention", h.retentionPolicies)
+		r.Put("/admin/rooms/{roomID}/retention", h.setRetentionPolicy)
+		r.Delete("/admin/rooms/{roomID}/retention", h.deleteRetentionPolicy)
+
+		// Maintenance metrics, along with the command line and memory statistics
+		r.Handle("/debug/vars", expvar.Handler())
+	})
+
+	return r
+}
+
+// search handles full-text message search
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+
+	params := r.URL.Query()
+	q := models.SearchQuery{
+		Query:  params.Get("q"),
+		RoomID: params.Get("room_id"),
+		UserID: params.Get("user_id"),
+		Limit:  defaultSearchLimit,
+	}
+	if q.Query == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Search query is required")
+		return
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'from' timestamp, expected RFC 3339")
+		return
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'to' timestamp, expected RFC 3339")
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		if q.Limit > maxSearchLimit {
+			q.Limit = maxSearchLimit
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid offset")
+			return
+		}
+	}
+
+	rooms, truncated, err := h.searchableRooms(r, claims, q)
+	if err != nil {
+		log.Printf("Error checking room access: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search messages")
+		return
+	}
+	if q.RoomID != "" && rooms != nil && len(rooms) == 0 {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Access to room denied")
+		return
+	}
+
+	results, err := h.repo.SearchMessages(r.Context(), rooms, q)
+	if err != nil {
+		log.Printf("Error searching messages: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search messages")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":         results,
+		"limit":           q.Limit,
+		"offset":          q.Offset,
+		"rooms_truncated": truncated,
+	})
+}
+
+// exportRoom streams a room's full history as NDJSON or as a zip with metadata
+func (h *Handler) exportRoom(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatNDJSON
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Unsupported export format")
+		return
+	}
+
+	allowed, err := h.canReadRoom(r, claims, roomID)
+	if err != nil {
+		log.Printf("Error checking room access: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export room")
+		return
+	}
+	if !allowed {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Access to room denied")
+		return
+	}
+
+	// Large rooms take longer to stream than the server's write timeout allows
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not lift write deadline for export: %v", err)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "room-"+roomID+"."+format))
+
+	ew := export.NewWriter(format, w, roomID)
+	if err := h.repo.ExportRoom(r.Context(), roomID, ew.Write); err != nil {
+		// Headers are already sent, so the truncated body is all the client will see
+		log.Printf("Error exporting room %s: %v", roomID, err)
+		return
+	}
+	if err := ew.Close(); err != nil {
+		log.Printf("Error finishing export of room %s: %v", roomID, err)
+	}
+}
+
+// roomHistory returns a page of a room's messages, newest first
+func (h *Handler) roomHistory(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	limit, offset := defaultHistoryLimit, 0
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		if limit > maxHistoryLimit {
+			limit = maxHistoryLimit
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid offset")
+			return
+		}
+	}
+
+	allowed, err := h.canReadRoom(r, claims, roomID)
+	if err != nil {
+		log.Printf("Error checking room access: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get messages")
+		return
+	}
+	if !allowed {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Access to room denied")
+		return
+	}
+
+	messages, err := h.repo.GetMessagesByRoom(r.Context(), roomID, limit, offset)
+	if err != nil {
+		log.Printf("Error getting messages of room %s: %v", roomID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get messages")
+		return
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// searchableRooms returns the rooms a search may cover: nil for all rooms if the caller may
+// read every room, and otherwise the rooms with matches that the caller may read. truncated
+// is set when matches in more than maxSearchRooms rooms left the least recently active out.
+func (h *Handler) searchableRooms(r *http.Request, claims *auth.Claims, q models.SearchQuery) (rooms []string, truncated bool, err error) {
+	if claims.HasRole(authz.RoleAdmin) || claims.HasScope(auth.ScopeRoomsAdmin) {
+		return nil, false, nil
+	}
+
+	candidates := []string{q.RoomID}
+	if q.RoomID == "" {
+		if candidates, err = h.repo.SearchRooms(r.Context(), q, maxSearchRooms+1); err != nil {
+			return nil, false, err
+		}
+		if len(candidates) > maxSearchRooms {
+			candidates, truncated = candidates[:maxSearchRooms], true
+		}
+	}
+	rooms, err = h.readableRooms(r, claims, candidates)
+	return rooms, truncated, err
+}
+
+// readableRooms returns those of the given rooms whose history the caller may read, by
+// the same rules as canReadRoom but with one batch of lookups for all of them
+func (h *Handler) readableRooms(r *http.Request, claims *auth.Claims, roomIDs []string) ([]string, error) {
+	token, _ := auth.BearerToken(r)
+	accesses, err := h.authorizer.AccessMany(r.Context(), claims, token, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var permitted, unmanaged []string
+	for _, roomID := range roomIDs {
+		access, ok := accesses[roomID]
+		if !ok || !authz.Can(claims, access, authz.PermReadMessages) {
+			continue
+		}
+		permitted = append(permitted, roomID)
+		if !access.Managed {
+			unmanaged = append(unmanaged, roomID)
+		}
+	}
+
+	participated := map[string]bool{}
+	if len(unmanaged) > 0 {
+		if participated, err = h.repo.ReadableRooms(r.Context(), claims.UserID, unmanaged); err != nil {
+			return nil, err
+		}
+	}
+
+	rooms := []string{}
+	for _, roomID := range permitted {
+		if accesses[roomID].Managed || participated[roomID] {
+			rooms = append(rooms, roomID)
+		}
+	}
+	return rooms, nil
+}
+
+// canReadRoom reports whether the caller may read a room's history. In rooms without
+// roles, where anyone may chat, history stays limited to the room's participants.
+func (h *Handler) canReadRoom(r *http.Request, claims *auth.Claims, roomID string) (bool, error) {
+	token, _ := auth.BearerToken(r)
+	access, err := h.authorizer.Access(r.Context(), claims, token, roomID)
+	if err != nil {
+		return false, err
+	}
+
+	if !authz.Can(claims, access, authz.PermReadMessages) {
+		return false, nil
+	}
+	if access.Managed || claims.HasRole(authz.RoleAdmin) || claims.HasScope(auth.ScopeRoomsAdmin) {
+		return true, nil
+	}
+	return h.repo.CanReadRoom(r.Context(), claims.UserID, roomID)
+}
+
+// exportContentTypes maps export formats to their response content type
+var exportContentTypes = map[string]string{
+	export.FormatNDJSON: "application/x-ndjson",
+	export.FormatZip:    "application/zip",
+}
+
+// healthCheck handles health checks
+func (h *Handler) healthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
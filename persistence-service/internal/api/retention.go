@@ -0,0 +1,75 @@
+// internal/api/retention.go
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/go-chi/chi/v5"
+)
+
+// Longest retention a room policy may set, about 100 years
+const maxRetainDays = 36500
+
+// retentionPolicies lists the rooms whose retention overrides the global rule, and the rule
+func (h *Handler) retentionPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.repo.ListRetentionPolicies(r.Context())
+	if err != nil {
+		log.Printf("Error listing retention policies: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list retention policies")
+		return
+	}
+	if policies == nil {
+		policies = []models.RetentionPolicy{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policies":           policies,
+		"global_retain_days": h.config.RetentionDays, // 0 if messages are kept forever
+	})
+}
+
+// setRetentionPolicy sets how many days a room's messages are kept. Messages past that are
+// deleted by the next maintenance run, even where the global rule keeps messages longer.
+func (h *Handler) setRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	var req struct {
+		RetainDays int `json:"retain_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if req.RetainDays <= 0 || req.RetainDays > maxRetainDays {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "retain_days must be between 1 and 36500")
+		return
+	}
+
+	if err := h.repo.SetRetentionPolicy(r.Context(), roomID, req.RetainDays); err != nil {
+		log.Printf("Error setting retention policy of room %s: %v", roomID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set retention policy")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RetentionPolicy{RoomID: roomID, RetainDays: req.RetainDays, UpdatedAt: time.Now().UTC()})
+}
+
+// deleteRetentionPolicy removes a room's retention policy, so the global rule applies again
+func (h *Handler) deleteRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+
+	if err := h.repo.DeleteRetentionPolicy(r.Context(), roomID); err != nil {
+		log.Printf("Error deleting retention policy of room %s: %v", roomID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete retention policy")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
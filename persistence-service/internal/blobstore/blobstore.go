@@ -0,0 +1,41 @@
+// internal/blobstore/blobstore.go
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// ErrNotFound is returned when an object does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+// Store is a minimal object store used to keep archived message history
+type Store interface {
+	// Put writes the object at key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Get opens the object at key for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object at key; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Open returns the Store described by rawURL, e.g. file:///var/lib/message-archive.
+// Only the local filesystem is supported for now; other schemes can be added here.
+func Open(rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewLocalStore(u.Path)
+	default:
+		return nil, fmt.Errorf("unsupported blob store scheme: %q", u.Scheme)
+	}
+}
@@ -0,0 +1,162 @@
+// internal/export/export.go
+
+// Package export implements the room export format used for data requests and for
+// moving rooms between deployments.
+//
+// A room can be exported in one of two layouts:
+//
+//   - ndjson: one JSON message object per line, oldest first.
+//   - zip: an archive holding messages.json, a JSON array of message objects oldest
+//     first, followed by metadata.json describing the export.
+//
+// Message objects carry id, user_id, username, content, room_id and created_at
+// (RFC 3339). The metadata records the format version, the room, the export time,
+// the message count, the time range and the hex SHA-256 of messages.json.
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+)
+
+// FormatVersion is the version written to metadata.json
+const FormatVersion = 1
+
+// Supported export layouts
+const (
+	FormatNDJSON = "ndjson"
+	FormatZip    = "zip"
+)
+
+// Names of the entries inside a zip export
+const (
+	messagesEntry = "messages.json"
+	metadataEntry = "metadata.json"
+)
+
+// Metadata describes a zip export
+type Metadata struct {
+	FormatVersion  int        `json:"format_version"`
+	RoomID         string     `json:"room_id"`
+	ExportedAt     time.Time  `json:"exported_at"`
+	MessageCount   int        `json:"message_count"`
+	FirstMessageAt *time.Time `json:"first_message_at,omitempty"`
+	LastMessageAt  *time.Time `json:"last_message_at,omitempty"`
+	Checksum       string     `json:"messages_sha256"`
+}
+
+// Writer writes messages in one of the export layouts
+type Writer interface {
+	// Write appends a message; messages must be written oldest first
+	Write(msg models.Message) error
+
+	// Close finishes the export; it does not close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a Writer for the given format, or nil if the format is unknown
+func NewWriter(format string, w io.Writer, roomID string) Writer {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}
+	case FormatZip:
+		return &zipWriter{zw: zip.NewWriter(w), meta: Metadata{FormatVersion: FormatVersion, RoomID: roomID}}
+	default:
+		return nil
+	}
+}
+
+// ndjsonWriter writes one message per line
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(msg models.Message) error {
+	return w.enc.Encode(msg)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// zipWriter streams messages.json and appends metadata.json once the count is known
+type zipWriter struct {
+	zw    *zip.Writer
+	entry io.Writer
+	hash  hash.Hash
+	meta  Metadata
+}
+
+// begin opens messages.json and starts the JSON array
+func (w *zipWriter) begin() error {
+	f, err := w.zw.Create(messagesEntry)
+	if err != nil {
+		return err
+	}
+	w.hash = sha256.New()
+	w.entry = io.MultiWriter(f, w.hash)
+	_, err = io.WriteString(w.entry, "[")
+	return err
+}
+
+func (w *zipWriter) Write(msg models.Message) error {
+	sep := ",\n"
+	if w.entry == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+		sep = "\n"
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w.entry, sep); err != nil {
+		return err
+	}
+	if _, err := w.entry.Write(data); err != nil {
+		return err
+	}
+
+	createdAt := msg.CreatedAt
+	if w.meta.FirstMessageAt == nil {
+		w.meta.FirstMessageAt = &createdAt
+	}
+	w.meta.LastMessageAt = &createdAt
+	w.meta.MessageCount++
+	return nil
+}
+
+func (w *zipWriter) Close() error {
+	// An empty room still gets a well-formed messages.json
+	if w.entry == nil {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w.entry, "\n]\n"); err != nil {
+		return err
+	}
+
+	w.meta.ExportedAt = time.Now().UTC()
+	w.meta.Checksum = hex.EncodeToString(w.hash.Sum(nil))
+	f, err := w.zw.Create(metadataEntry)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w.meta); err != nil {
+		return err
+	}
+
+	return w.zw.Close()
+}
@@ -0,0 +1,132 @@
+// internal/export/reader.go
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+)
+
+// zipMagic is the signature at the start of every zip file
+var zipMagic = []byte("PK\x03\x04")
+
+// ReadFile reads an export in either layout and calls fn for every message, oldest first.
+// For zip exports the metadata is returned after the message count and checksum have been
+// verified; NDJSON exports carry no metadata and return nil.
+func ReadFile(path string, fn func(models.Message) error) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(f, head); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(head, zipMagic) {
+		return readZip(path, fn)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return nil, readNDJSON(f, fn)
+}
+
+// readNDJSON reads one message per line
+func readNDJSON(r io.Reader, fn func(models.Message) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var msg models.Message
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding message: %w", err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// readZip reads metadata.json and streams messages.json, verifying both against each other
+func readZip(path string, fn func(models.Message) error) (*Metadata, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var meta Metadata
+	if err := decodeEntry(&zr.Reader, metadataEntry, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&meta)
+	}); err != nil {
+		return nil, err
+	}
+	if meta.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported export format version %d", meta.FormatVersion)
+	}
+
+	count := 0
+	hash := sha256.New()
+	err = decodeEntry(&zr.Reader, messagesEntry, func(r io.Reader) error {
+		tee := io.TeeReader(r, hash)
+		dec := json.NewDecoder(tee)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return errors.New("messages.json is not a JSON array")
+		}
+		for dec.More() {
+			var msg models.Message
+			if err := dec.Decode(&msg); err != nil {
+				return fmt.Errorf("decoding message: %w", err)
+			}
+			if err := fn(msg); err != nil {
+				return err
+			}
+			count++
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		// Hash the trailing bytes the decoder has not read yet
+		_, err := io.Copy(io.Discard, tee)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if count != meta.MessageCount {
+		return nil, fmt.Errorf("export holds %d messages but metadata lists %d", count, meta.MessageCount)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != meta.Checksum {
+		return nil, errors.New("messages.json failed checksum verification")
+	}
+
+	return &meta, nil
+}
+
+// decodeEntry opens the named zip entry and passes it to fn, draining it afterwards
+func decodeEntry(zr *zip.Reader, name string, fn func(io.Reader) error) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("export is missing %s: %w", name, err)
+	}
+	defer f.Close()
+
+	if err := fn(f); err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, f)
+	return err
+}
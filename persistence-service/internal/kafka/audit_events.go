@@ -0,0 +1,82 @@
+// internal/kafka/audit_events.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"time"
+)
+
+// AuditEventConsumer consumes the audit events of the other services into the audit log
+type AuditEventConsumer struct {
+	reader *kafka.Reader
+	repo   *repository.Repository
+}
+
+// NewAuditEventConsumer creates a new Kafka consumer for the audit events topic
+func NewAuditEventConsumer(cfg *config.Config, repo *repository.Repository) (*AuditEventConsumer, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  cfg.KafkaBrokers,
+		Topic:    cfg.KafkaAuditTopic,
+		GroupID:  cfg.KafkaGroupID + "-audit",
+		MinBytes: 1,
+		MaxBytes: 10e6, // 10MB
+		// Events published while the service was down must still be recorded
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     500 * time.Millisecond,
+	})
+
+	return &AuditEventConsumer{
+		reader: reader,
+		repo:   repo,
+	}, nil
+}
+
+// Consume records audit events until ctx is canceled. An event is retried until it has
+// been recorded and only then committed, so the log has no gaps.
+func (c *AuditEventConsumer) Consume(ctx context.Context) error {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Error reading audit event: %v", err)
+			continue
+		}
+
+		var event models.AuditEvent
+		if err := json.Unmarshal(m.Value, &event); err != nil {
+			log.Printf("Error unmarshaling audit event: %v", err)
+		} else if event.EventID == "" || event.Action == "" {
+			log.Printf("Skipping audit event without an ID or action from %s", event.Service)
+		} else {
+			for {
+				err := c.repo.AppendAuditEvent(ctx, event)
+				if err == nil {
+					break
+				}
+				log.Printf("Error recording %s audit event %s, retrying: %v", event.Action, event.EventID, err)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+
+		if err := c.reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			log.Printf("Error committing audit event: %v", err)
+		}
+	}
+}
+
+// Close closes the Kafka consumer
+func (c *AuditEventConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -73,6 +73,7 @@ func (c *Consumer) Consume(ctx context.Context) error {
 					Content:   kafkaMsg.Content,
 					RoomID:    kafkaMsg.RoomID,
 					CreatedAt: kafkaMsg.Timestamp,
+					Bot:       kafkaMsg.Bot,
 				}
 
 				if err := c.repo.SaveMessage(ctx, message); err != nil {
@@ -0,0 +1,101 @@
+// internal/kafka/user_events.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+	"github.com/segmentio/kafka-go"
+	"log"
+	"time"
+)
+
+// UserEventConsumer consumes user account events and applies them to stored messages
+type UserEventConsumer struct {
+	reader *kafka.Reader
+	repo   *repository.Repository
+	policy string
+}
+
+// NewUserEventConsumer creates a new Kafka consumer for the user events topic
+func NewUserEventConsumer(cfg *config.Config, repo *repository.Repository) (*UserEventConsumer, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  cfg.KafkaBrokers,
+		Topic:    cfg.KafkaUserEventsTopic,
+		GroupID:  cfg.KafkaGroupID + "-user-events",
+		MinBytes: 1,
+		MaxBytes: 10e6, // 10MB
+		// Deletions published while the service was down must still be applied
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     500 * time.Millisecond,
+	})
+
+	return &UserEventConsumer{
+		reader: reader,
+		repo:   repo,
+		policy: cfg.UserDeletionPolicy,
+	}, nil
+}
+
+// Consume consumes user events until ctx is canceled. An event is retried until it has
+// been applied and only then committed, so no deletion is ever skipped.
+func (c *UserEventConsumer) Consume(ctx context.Context) error {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("Error reading user event: %v", err)
+			continue
+		}
+
+		var event models.UserEvent
+		if err := json.Unmarshal(m.Value, &event); err != nil {
+			log.Printf("Error unmarshaling user event: %v", err)
+		} else {
+			for {
+				err := c.handle(ctx, event)
+				if err == nil {
+					break
+				}
+				log.Printf("Error handling %s event %s, retrying: %v", event.EventType, event.EventID, err)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+
+		if err := c.reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			log.Printf("Error committing user event: %v", err)
+		}
+	}
+}
+
+// handle applies a single user event
+func (c *UserEventConsumer) handle(ctx context.Context, event models.UserEvent) error {
+	switch event.EventType {
+	case models.EventUserDeleted:
+		n, err := c.repo.ForgetUser(ctx, event, c.policy)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %s policy to %d messages of deleted user %s", c.policy, n, event.UserID)
+	case models.EventUsernameChanged:
+		n, err := c.repo.RenameUser(ctx, event.UserID, event.Username)
+		if err != nil {
+			return err
+		}
+		log.Printf("Renamed user %s on %d messages", event.UserID, n)
+	}
+	return nil
+}
+
+// Close closes the Kafka consumer
+func (c *UserEventConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,180 @@
+// internal/maintenance/maintenance.go
+package maintenance
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/repository"
+)
+
+// Metrics published on /debug/vars
+var (
+	// Rows removed by retention, keyed by "room_policy", "global", "partition_drop" and "archive"
+	purgedRows = expvar.NewMap("retention_purged_rows")
+
+	// Rows moved from the messages table into the archive
+	archivedRows = expvar.NewInt("archive_archived_rows_total")
+
+	// Unix time of the last completed maintenance run
+	lastRun = expvar.NewInt("maintenance_last_run_unix")
+)
+
+// Runner periodically maintains the messages table: it creates upcoming partitions,
+// archives old messages and enforces the global and per-room retention rules.
+type Runner struct {
+	repo   *repository.Repository
+	config *config.Config
+}
+
+// NewRunner creates a new Runner
+func NewRunner(repo *repository.Repository, cfg *config.Config) *Runner {
+	return &Runner{
+		repo:   repo,
+		config: cfg,
+	}
+}
+
+// Run performs maintenance immediately and then on every interval until ctx is canceled
+func (r *Runner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce performs a single maintenance pass, logging rather than aborting on errors
+func (r *Runner) runOnce(ctx context.Context) {
+	if err := r.repo.EnsurePartitions(ctx, r.config.PartitionPremakeMonths); err != nil {
+		log.Printf("Error creating partitions: %v", err)
+	}
+
+	if r.config.ArchiveAfterDays > 0 {
+		if err := r.archive(ctx, time.Now()); err != nil {
+			log.Printf("Error archiving messages: %v", err)
+		}
+	}
+
+	if err := r.applyRetention(ctx, time.Now()); err != nil {
+		log.Printf("Error applying retention: %v", err)
+	}
+
+	lastRun.Set(time.Now().Unix())
+}
+
+// archive moves messages older than the archive age into the blob store and drops
+// partitions that archiving has emptied
+func (r *Runner) archive(ctx context.Context, now time.Time) error {
+	cutoff := now.AddDate(0, 0, -r.config.ArchiveAfterDays)
+
+	n, err := r.repo.ArchiveBefore(ctx, cutoff)
+	archivedRows.Add(n)
+	if n > 0 {
+		log.Printf("Archived %d messages created before %s", n, cutoff.Format(time.RFC3339))
+	}
+	if err != nil {
+		return err
+	}
+
+	partitions, err := r.repo.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			break
+		}
+		dropped, err := r.repo.DropPartitionIfEmpty(ctx, p)
+		if err != nil {
+			return err
+		}
+		if dropped {
+			log.Printf("Dropped archived partition %s", p.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyRetention deletes messages that have outlived their room's policy or the global rule
+func (r *Runner) applyRetention(ctx context.Context, now time.Time) error {
+	policies, err := r.repo.ListRetentionPolicies(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(policies) > 0 {
+		n, err := r.repo.PurgeByRoomPolicies(ctx, now)
+		r.recordPurge("room_policy", n)
+		if err != nil {
+			return err
+		}
+		n, err = r.repo.PurgeArchivesByRoomPolicies(ctx, now)
+		r.recordPurge("archive", n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.config.RetentionDays == 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -r.config.RetentionDays)
+
+	// Whole partitions past the cutoff can be dropped cheaply, but only when no room
+	// policy asks to keep messages longer than the global rule.
+	canDrop := true
+	for _, p := range policies {
+		if p.RetainDays > r.config.RetentionDays {
+			canDrop = false
+			break
+		}
+	}
+	if canDrop {
+		partitions, err := r.repo.ListPartitions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			if p.To.After(cutoff) {
+				break
+			}
+			n, err := r.repo.DropPartition(ctx, p)
+			if err != nil {
+				return err
+			}
+			r.recordPurge("partition_drop", n)
+			log.Printf("Dropped expired partition %s (%d rows)", p.Name, n)
+		}
+	}
+
+	n, err := r.repo.PurgeOlderThan(ctx, cutoff)
+	r.recordPurge("global", n)
+	if err != nil {
+		return err
+	}
+
+	n, err = r.repo.PurgeArchivesOlderThan(ctx, cutoff)
+	r.recordPurge("archive", n)
+	return err
+}
+
+// recordPurge adds purged rows to the retention metrics
+func (r *Runner) recordPurge(reason string, rows int64) {
+	if rows == 0 {
+		return
+	}
+	purgedRows.Add(reason, rows)
+	log.Printf("Retention purged %d rows (%s)", rows, reason)
+}
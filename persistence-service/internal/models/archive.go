@@ -0,0 +1,25 @@
+// internal/models/archive.go
+package models
+
+import (
+	"time"
+)
+
+// ArchiveFormatNDJSONGzip is gzip-compressed newline-delimited JSON, one Message per line
+const ArchiveFormatNDJSONGzip = "ndjson+gzip"
+
+// ArchiveManifest records one archived object holding a room's messages for a time range
+type ArchiveManifest struct {
+	ID         int64     `json:"id" db:"id"`
+	RoomID     string    `json:"room_id" db:"room_id"`
+	ObjectKey  string    `json:"object_key" db:"object_key"`
+	Format     string    `json:"format" db:"format"`
+	Checksum   string    `json:"checksum" db:"checksum"` // hex SHA-256 of the stored object
+	RowCount   int       `json:"row_count" db:"row_count"`
+	RangeStart time.Time `json:"range_start" db:"range_start"`
+	RangeEnd   time.Time `json:"range_end" db:"range_end"`
+	ArchivedAt time.Time `json:"archived_at" db:"archived_at"`
+
+	// Authors of the archived messages, indexed in archive_authors rather than stored on the manifest
+	UserIDs []string `json:"-" db:"-"`
+}
@@ -0,0 +1,51 @@
+// internal/models/audit.go
+package models
+
+import (
+	"time"
+)
+
+// AuditEvent is a security-relevant action published by another service
+type AuditEvent struct {
+	EventID   string    `json:"event_id"`
+	Service   string    `json:"service"`
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actor_id,omitempty"`  // user or client that acted; empty if not authenticated
+	TargetID  string    `json:"target_id,omitempty"` // user the action was taken on, if not the actor
+	RoomID    string    `json:"room_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Action-specific details, e.g. the login method or the reason of a failure
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// AuditRecord is an audit event as stored in the audit log. Hash covers the event and
+// PrevHash, the hash of the record before it, so altering or removing a record breaks
+// the chain after it.
+type AuditRecord struct {
+	Seq int64 `json:"seq"`
+	AuditEvent
+	RecordedAt time.Time `json:"recorded_at"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// AuditQuery holds the filters for listing audit records
+type AuditQuery struct {
+	ActorID string
+	Action  string
+	From    *time.Time
+	To      *time.Time
+	Limit   int
+	Offset  int
+}
+
+// AuditVerification is the result of checking the audit log's hash chain
+type AuditVerification struct {
+	Valid   bool  `json:"valid"`
+	Checked int64 `json:"checked"` // records checked, up to and including the first broken one
+
+	// Seq of the first record that does not match its hash or predecessor
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
@@ -0,0 +1,30 @@
+// internal/models/event.go
+package models
+
+import (
+	"time"
+)
+
+// User event types consumed from the user events topic
+const (
+	EventUserDeleted     = "user_deleted"
+	EventUsernameChanged = "username_changed"
+)
+
+// UserEvent is published by the auth service when something happens to a user account
+type UserEvent struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"` // e.g., "user_deleted"
+	UserID    string    `json:"user_id"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Set on username_changed events to the new username
+	Username string `json:"username,omitempty"`
+}
+
+// Placeholder attribution for messages of deleted users under the anonymize policy
+const (
+	DeletedUserID   = "00000000-0000-0000-0000-000000000000"
+	DeletedUsername = "[deleted]"
+)
@@ -7,12 +7,13 @@ import (
 
 // Message represents a chat message
 type Message struct {
-	ID        string    `db:"id"`
-	UserID    string    `db:"user_id"`
-	Username  string    `db:"username"`
-	Content   string    `db:"content"`
-	RoomID    string    `db:"room_id"`
-	CreatedAt time.Time `db:"created_at"`
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Content   string    `json:"content" db:"content"`
+	RoomID    string    `json:"room_id" db:"room_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Bot       bool      `json:"bot,omitempty" db:"bot"` // sent by a service client rather than a user
 }
 
 // KafkaMessage represents a message that is consumed from Kafka
@@ -24,4 +25,5 @@ type KafkaMessage struct {
 	RoomID    string    `json:"room_id"`
 	Timestamp time.Time `json:"timestamp"`
 	EventType string    `json:"event_type"` // e.g., "message_created", "message_updated"
+	Bot       bool      `json:"bot,omitempty"`
 }
@@ -0,0 +1,13 @@
+// internal/models/retention.go
+package models
+
+import (
+	"time"
+)
+
+// RetentionPolicy overrides the global retention rule for a single room
+type RetentionPolicy struct {
+	RoomID     string    `json:"room_id" db:"room_id"`
+	RetainDays int       `json:"retain_days" db:"retain_days"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
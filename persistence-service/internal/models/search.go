@@ -0,0 +1,26 @@
+// internal/models/search.go
+package models
+
+import (
+	"time"
+)
+
+// SearchQuery holds the filters for a full-text message search
+type SearchQuery struct {
+	Query  string
+	RoomID string
+	UserID string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a message matched by a search, with its rank and a highlighted snippet
+type SearchResult struct {
+	Message
+	Rank float64 `json:"rank"`
+
+	// HTML: the escaped content around the matches, which are wrapped in <mark>
+	Highlight string `json:"highlight"`
+}
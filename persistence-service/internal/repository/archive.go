@@ -0,0 +1,486 @@
+// internal/repository/archive.go
+package repository
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrArchiveDisabled is returned by archive operations when no blob store is configured
+var ErrArchiveDisabled = errors.New("archiving is not configured")
+
+// ArchiveBefore moves every message created before cutoff out of the messages table and into
+// the blob store. Messages are kept in one compressed NDJSON object per room and month.
+func (r *Repository) ArchiveBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if r.archive == nil {
+		return 0, ErrArchiveDisabled
+	}
+
+	query := `
+	SELECT room_id, date_trunc('month', created_at) AS month
+	FROM messages
+	WHERE created_at < $1
+	GROUP BY room_id, month
+	ORDER BY month, room_id
+	`
+	rows, err := r.db.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	type group struct {
+		roomID string
+		month  time.Time
+	}
+	var groups []group
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.roomID, &g.month); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, g := range groups {
+		end := g.month.AddDate(0, 1, 0)
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		n, err := r.archiveRange(ctx, g.roomID, g.month, end)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// archiveRange archives a room's messages created in [from, to), where from is the start of
+// a month. Any earlier archives of the month are merged into the new object, so each room
+// and month keeps a single object and archived history never overlaps.
+// The export, manifest changes and delete share one repeatable-read snapshot, so messages
+// that arrive in the range while the object is being written stay in the table.
+func (r *Repository) archiveRange(ctx context.Context, roomID string, from, to time.Time) (int, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	unlock, err := lockArchiveMonth(ctx, conn, roomID, from)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	previous, err := scanManifests(tx.QueryContext(ctx, `
+	SELECT id, room_id, object_key, format, checksum, row_count, range_start, range_end, archived_at
+	FROM message_archives
+	WHERE room_id = $1 AND range_start >= $2 AND range_start < $3
+	`, roomID, from, from.AddDate(0, 1, 0)))
+	if err != nil {
+		return 0, err
+	}
+	var archived []models.Message
+	var previousIDs []int64
+	for _, m := range previous {
+		messages, err := r.readArchive(ctx, m)
+		if err != nil {
+			return 0, err
+		}
+		archived = append(archived, messages...)
+		previousIDs = append(previousIDs, m.ID)
+	}
+	sort.SliceStable(archived, func(i, j int) bool {
+		return archived[i].CreatedAt.Before(archived[j].CreatedAt)
+	})
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT id, user_id, username, content, room_id, created_at, bot
+	FROM messages
+	WHERE room_id = $1 AND created_at >= $2 AND created_at < $3
+	ORDER BY created_at
+	`, roomID, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := models.ArchiveManifest{
+		RoomID:    roomID,
+		ObjectKey: archiveKey(roomID, from),
+		Format:    models.ArchiveFormatNDJSONGzip,
+	}
+
+	// Merge the new messages into the archived ones, oldest first
+	err = r.putArchive(ctx, &manifest, func(emit func(models.Message) error) error {
+		for rows.Next() {
+			var msg models.Message
+			if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.RoomID, &msg.CreatedAt, &msg.Bot); err != nil {
+				return err
+			}
+			for len(archived) > 0 && archived[0].CreatedAt.Before(msg.CreatedAt) {
+				if err := emit(archived[0]); err != nil {
+					return err
+				}
+				archived = archived[1:]
+			}
+			if err := emit(msg); err != nil {
+				return err
+			}
+		}
+		for _, msg := range archived {
+			if err := emit(msg); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	added := manifest.RowCount
+	for _, m := range previous {
+		added -= m.RowCount
+	}
+	if added == 0 {
+		r.deleteObject(manifest.ObjectKey)
+		return 0, nil
+	}
+
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO message_archives (room_id, object_key, format, checksum, row_count, range_start, range_end)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+	`, manifest.RoomID, manifest.ObjectKey, manifest.Format, manifest.Checksum, manifest.RowCount, manifest.RangeStart, manifest.RangeEnd).Scan(&manifest.ID)
+	if err == nil {
+		err = indexArchiveAuthors(ctx, tx, manifest.ID, manifest.UserIDs)
+	}
+	if err != nil {
+		r.deleteObject(manifest.ObjectKey)
+		return 0, err
+	}
+
+	if len(previousIDs) > 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM message_archives WHERE id = ANY($1)", pq.Array(previousIDs)); err != nil {
+			r.deleteObject(manifest.ObjectKey)
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM messages WHERE room_id = $1 AND created_at >= $2 AND created_at < $3", roomID, from, to)
+	if err != nil {
+		r.deleteObject(manifest.ObjectKey)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.deleteObject(manifest.ObjectKey)
+		return 0, err
+	}
+
+	// The merged object replaces the earlier ones
+	for _, m := range previous {
+		r.deleteObject(m.ObjectKey)
+	}
+	return added, nil
+}
+
+// lockArchiveMonth takes a session lock on conn for a room's archive of a month, so that
+// replicas archiving or rewriting it do not overwrite each other's objects. The lock is
+// taken before any transaction starts, so its snapshot sees what the last holder committed.
+func lockArchiveMonth(ctx context.Context, conn *sql.Conn, roomID string, month time.Time) (func(), error) {
+	key := roomID + "/" + month.Format("2006-01")
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", key); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			log.Printf("Error releasing archive lock %s: %v", key, err)
+		}
+	}, nil
+}
+
+// indexArchiveAuthors records who wrote the messages in an archived object, so that erasing
+// a user only rewrites the objects holding their messages
+func indexArchiveAuthors(ctx context.Context, tx *sql.Tx, archiveID int64, userIDs []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM archive_authors WHERE archive_id = $1", archiveID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO archive_authors (user_id, archive_id)
+	SELECT DISTINCT unnest($2::text[]), $1
+	`, archiveID, pq.Array(userIDs))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE message_archives SET authors_indexed = TRUE WHERE id = $1", archiveID)
+	return err
+}
+
+// archiveMonth returns the start of the month an archived object covers
+func archiveMonth(rangeStart time.Time) time.Time {
+	return time.Date(rangeStart.Year(), rangeStart.Month(), 1, 0, 0, 0, 0, rangeStart.Location())
+}
+
+// archiveKey returns a new, unique object key for a room's messages from the given month
+func archiveKey(roomID string, month time.Time) string {
+	return fmt.Sprintf("rooms/%s/%s/%d.ndjson.gz", url.PathEscape(roomID), month.Format("2006-01"), time.Now().UnixNano())
+}
+
+// putArchive streams the messages produced by each into a new object at manifest.ObjectKey,
+// filling in the manifest's row count, time range, authors and checksum. Messages must be
+// emitted oldest first.
+func (r *Repository) putArchive(ctx context.Context, manifest *models.ArchiveManifest, each func(emit func(models.Message) error) error) error {
+	manifest.RowCount = 0
+	authors := make(map[string]bool)
+
+	// Stream straight into the store while hashing the compressed bytes
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+	encodeErr := make(chan error, 1)
+	go func() {
+		gz := gzip.NewWriter(io.MultiWriter(pw, hash))
+		enc := json.NewEncoder(gz)
+		err := each(func(msg models.Message) error {
+			if manifest.RowCount == 0 {
+				manifest.RangeStart = msg.CreatedAt
+			}
+			manifest.RangeEnd = msg.CreatedAt
+			manifest.RowCount++
+			authors[msg.UserID] = true
+			return enc.Encode(msg)
+		})
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+		encodeErr <- err
+	}()
+
+	putErr := r.archive.Put(ctx, manifest.ObjectKey, pr)
+	pr.CloseWithError(putErr)
+	err := <-encodeErr
+	if putErr != nil {
+		return putErr
+	}
+	if err != nil {
+		r.deleteObject(manifest.ObjectKey)
+		return err
+	}
+
+	manifest.Checksum = hex.EncodeToString(hash.Sum(nil))
+	manifest.UserIDs = make([]string, 0, len(authors))
+	for userID := range authors {
+		manifest.UserIDs = append(manifest.UserIDs, userID)
+	}
+	sort.Strings(manifest.UserIDs)
+	return nil
+}
+
+// deleteObject removes an object that is not referenced by any manifest
+func (r *Repository) deleteObject(key string) {
+	if err := r.archive.Delete(context.Background(), key); err != nil {
+		log.Printf("Error removing orphaned archive object %s: %v", key, err)
+	}
+}
+
+// listArchiveManifests returns a room's archive manifests, newest range first
+func (r *Repository) listArchiveManifests(ctx context.Context, roomID string) ([]models.ArchiveManifest, error) {
+	return scanManifests(r.db.QueryContext(ctx, `
+	SELECT id, room_id, object_key, format, checksum, row_count, range_start, range_end, archived_at
+	FROM message_archives
+	WHERE room_id = $1
+	ORDER BY range_end DESC
+	`, roomID))
+}
+
+// scanManifests reads the rows of a manifest query
+func scanManifests(rows *sql.Rows, err error) ([]models.ArchiveManifest, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var manifests []models.ArchiveManifest
+	for rows.Next() {
+		var m models.ArchiveManifest
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.ObjectKey, &m.Format, &m.Checksum, &m.RowCount, &m.RangeStart, &m.RangeEnd, &m.ArchivedAt); err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, rows.Err()
+}
+
+// getArchivedMessages pages through a room's archived messages, newest first
+func (r *Repository) getArchivedMessages(ctx context.Context, roomID string, limit, offset int) ([]models.Message, error) {
+	manifests, err := r.listArchiveManifests(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.Message
+	for _, m := range manifests {
+		if len(messages) >= limit {
+			break
+		}
+		// Skip whole objects using the manifest row counts
+		if offset >= m.RowCount {
+			offset -= m.RowCount
+			continue
+		}
+
+		archived, err := r.readArchive(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(archived, func(i, j int) bool {
+			return archived[i].CreatedAt.After(archived[j].CreatedAt)
+		})
+
+		archived = archived[offset:]
+		offset = 0
+		if remaining := limit - len(messages); len(archived) > remaining {
+			archived = archived[:remaining]
+		}
+		messages = append(messages, archived...)
+	}
+
+	return messages, nil
+}
+
+// readArchive loads an archived object and verifies it against the manifest checksum
+func (r *Repository) readArchive(ctx context.Context, m models.ArchiveManifest) ([]models.Message, error) {
+	if m.Format != models.ArchiveFormatNDJSONGzip {
+		return nil, fmt.Errorf("unsupported archive format %q for %s", m.Format, m.ObjectKey)
+	}
+
+	obj, err := r.archive.Get(ctx, m.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive %s: %w", m.ObjectKey, err)
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	tee := io.TeeReader(obj, hash)
+	gz, err := gzip.NewReader(tee)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive %s: %w", m.ObjectKey, err)
+	}
+
+	messages := make([]models.Message, 0, m.RowCount)
+	dec := json.NewDecoder(gz)
+	for {
+		var msg models.Message
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding archive %s: %w", m.ObjectKey, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	// Hash any trailing bytes the decompressor did not need
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != m.Checksum {
+		return nil, fmt.Errorf("archive %s failed checksum verification", m.ObjectKey)
+	}
+
+	return messages, nil
+}
+
+// PurgeArchivesByRoomPolicies deletes archived objects that are entirely older than their room's retention policy
+func (r *Repository) PurgeArchivesByRoomPolicies(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+	SELECT a.id, a.object_key, a.row_count
+	FROM message_archives a
+	JOIN retention_policies p ON p.room_id = a.room_id
+	WHERE a.range_end < $1::timestamp - p.retain_days * INTERVAL '1 day'
+	`
+	return r.purgeArchives(ctx, query, now)
+}
+
+// PurgeArchivesOlderThan deletes archived objects entirely older than cutoff in rooms without a retention policy
+func (r *Repository) PurgeArchivesOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+	SELECT a.id, a.object_key, a.row_count
+	FROM message_archives a
+	WHERE a.range_end < $1
+	AND NOT EXISTS (SELECT 1 FROM retention_policies p WHERE p.room_id = a.room_id)
+	`
+	return r.purgeArchives(ctx, query, cutoff)
+}
+
+// purgeArchives deletes the objects and manifests selected by query and returns the rows they held
+func (r *Repository) purgeArchives(ctx context.Context, query string, arg time.Time) (int64, error) {
+	if r.archive == nil {
+		return 0, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	type expired struct {
+		id       int64
+		key      string
+		rowCount int64
+	}
+	var objects []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.key, &e.rowCount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		objects = append(objects, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, e := range objects {
+		if err := r.archive.Delete(ctx, e.key); err != nil {
+			return total, err
+		}
+		if _, err := r.db.ExecContext(ctx, "DELETE FROM message_archives WHERE id = $1", e.id); err != nil {
+			return total, err
+		}
+		total += e.rowCount
+	}
+
+	return total, nil
+}
@@ -0,0 +1,215 @@
+// internal/repository/audit.go
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+)
+
+// auditGenesisHash is the previous hash of the first record in the audit log
+var auditGenesisHash = strings.Repeat("0", 64)
+
+// AppendAuditEvent appends an event to the audit log, chained to the record before it.
+// Events already in the log are skipped, so redelivered events are recorded once.
+func (r *Repository) AppendAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	// Hash what is stored: timestamps have microsecond precision and no zone, and text
+	// that does not fit a column would keep the event from ever being recorded
+	event.Timestamp = event.Timestamp.UTC().Truncate(time.Microsecond)
+	event.EventID = auditText(event.EventID, 36)
+	event.Service = auditText(event.Service, 50)
+	event.Action = auditText(event.Action, 50)
+	event.ActorID = auditText(event.ActorID, 36)
+	event.TargetID = auditText(event.TargetID, 36)
+	event.RoomID = auditText(event.RoomID, 36)
+	event.IPAddress = auditText(event.IPAddress, 45)
+	if event.Details != nil {
+		clean := make(map[string]string, len(event.Details))
+		for k, v := range event.Details {
+			clean[auditText(k, 100)] = auditText(v, 1000)
+		}
+		event.Details = clean
+	}
+
+	details := []byte("{}")
+	if event.Details != nil {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Appends are serialized so that each one links to the latest record
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM audit_log WHERE event_id = $1)", event.EventID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	prevHash := auditGenesisHash
+	err = tx.QueryRowContext(ctx, "SELECT hash FROM audit_log ORDER BY seq DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	hash, err := auditHash(prevHash, event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO audit_log (event_id, service, action, actor_id, target_id, room_id, ip_address, details, occurred_at, prev_hash, hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, event.EventID, event.Service, event.Action, event.ActorID, event.TargetID, event.RoomID, event.IPAddress,
+		details, event.Timestamp, prevHash, hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// QueryAuditLog returns the audit records matching q, newest first
+func (r *Repository) QueryAuditLog(ctx context.Context, q models.AuditQuery) ([]models.AuditRecord, error) {
+	var args []interface{}
+	conditions := []string{"TRUE"}
+
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if q.ActorID != "" {
+		addCondition("actor_id = $%d", q.ActorID)
+	}
+	if q.Action != "" {
+		addCondition("action = $%d", q.Action)
+	}
+	if q.From != nil {
+		addCondition("occurred_at >= $%d", q.From.UTC())
+	}
+	if q.To != nil {
+		addCondition("occurred_at < $%d", q.To.UTC())
+	}
+
+	args = append(args, q.Limit, q.Offset)
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM audit_log
+	WHERE %s
+	ORDER BY seq DESC
+	LIMIT $%d OFFSET $%d
+	`, auditColumns, strings.Join(conditions, " AND "), len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []models.AuditRecord{}
+	for rows.Next() {
+		record, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, rows.Err()
+}
+
+// VerifyAuditLog walks the audit log in order and checks that every record links to the
+// one before it and matches its hash. Records removed from the end of the log leave no
+// trace in the chain; compare the latest hash with a copy kept elsewhere to detect that.
+func (r *Repository) VerifyAuditLog(ctx context.Context) (*models.AuditVerification, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_log ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.AuditVerification{Valid: true}
+	prevHash := auditGenesisHash
+	for rows.Next() {
+		record, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Checked++
+
+		hash, err := auditHash(prevHash, record.AuditEvent)
+		if err != nil {
+			return nil, err
+		}
+		if record.PrevHash != prevHash || record.Hash != hash {
+			result.Valid = false
+			result.BrokenAt = &record.Seq
+			return result, nil
+		}
+		prevHash = record.Hash
+	}
+	return result, rows.Err()
+}
+
+// auditColumns are the audit_log columns read by scanAuditRecord
+const auditColumns = "seq, event_id, service, action, actor_id, target_id, room_id, ip_address, details, occurred_at, recorded_at, prev_hash, hash"
+
+// scanAuditRecord scans a row of auditColumns
+func scanAuditRecord(rows *sql.Rows) (*models.AuditRecord, error) {
+	var record models.AuditRecord
+	var details []byte
+	if err := rows.Scan(&record.Seq, &record.EventID, &record.Service, &record.Action, &record.ActorID,
+		&record.TargetID, &record.RoomID, &record.IPAddress, &details, &record.Timestamp, &record.RecordedAt,
+		&record.PrevHash, &record.Hash); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(details, &record.Details); err != nil {
+		return nil, err
+	}
+	record.Timestamp = record.Timestamp.UTC()
+	record.RecordedAt = record.RecordedAt.UTC()
+	return &record, nil
+}
+
+// auditText makes s storable in a text column of n characters: PostgreSQL rejects NUL
+// characters, and longer text is cut off
+func auditText(s string, n int) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// auditHash chains an event to the record before it: the hex SHA-256 of the previous hash
+// followed by the event's JSON encoding, whose field order is fixed and map keys sorted
+func auditHash(prevHash string, event models.AuditEvent) (string, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
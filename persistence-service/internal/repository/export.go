@@ -0,0 +1,141 @@
+// internal/repository/export.go
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// CanReadRoom reports whether a user may read a room's history, which is the case once they have posted in it
+func (r *Repository) CanReadRoom(ctx context.Context, userID, roomID string) (bool, error) {
+	var ok bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM messages WHERE room_id = $1 AND user_id = $2)",
+		roomID, userID).Scan(&ok)
+	return ok, err
+}
+
+// ReadableRooms returns those of the given rooms whose history a user may read by CanReadRoom
+func (r *Repository) ReadableRooms(ctx context.Context, userID string, roomIDs []string) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+	SELECT room.id
+	FROM unnest($2::text[]) AS room(id)
+	WHERE EXISTS (SELECT 1 FROM messages WHERE room_id = room.id AND user_id = $1)
+	`, userID, pq.Array(roomIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readable := make(map[string]bool)
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		readable[roomID] = true
+	}
+	return readable, rows.Err()
+}
+
+// ExportRoom calls fn for every message in a room, oldest first, including archived history
+func (r *Repository) ExportRoom(ctx context.Context, roomID string, fn func(models.Message) error) error {
+	if r.archive != nil {
+		manifests, err := r.listArchiveManifests(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		// Manifests are listed newest first
+		for i := len(manifests) - 1; i >= 0; i-- {
+			archived, err := r.readArchive(ctx, manifests[i])
+			if err != nil {
+				return err
+			}
+			sort.Slice(archived, func(i, j int) bool {
+				return archived[i].CreatedAt.Before(archived[j].CreatedAt)
+			})
+			for _, msg := range archived {
+				if err := fn(msg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	query := `
+	SELECT id, user_id, username, content, room_id, created_at, bot
+	FROM messages
+	WHERE room_id = $1
+	ORDER BY created_at ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.UserID,
+			&msg.Username,
+			&msg.Content,
+			&msg.RoomID,
+			&msg.CreatedAt,
+			&msg.Bot,
+		); err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportMessages bulk-loads messages in a single transaction, keeping their original IDs and
+// timestamps. fn is handed a save function for each message; if fn fails nothing is imported.
+// Messages that already exist are skipped, so an import can be safely re-run.
+func (r *Repository) ImportMessages(ctx context.Context, fn func(save func(models.Message) error) error) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO messages (id, user_id, username, content, room_id, created_at, bot)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id, created_at) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var imported int64
+	err = fn(func(msg models.Message) error {
+		res, err := stmt.ExecContext(ctx, msg.ID, msg.UserID, msg.Username, msg.Content, msg.RoomID, msg.CreatedAt, msg.Bot)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		imported += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Imported history usually predates the existing partitions
+	if err := partitionDefaultRows(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	return imported, tx.Commit()
+}
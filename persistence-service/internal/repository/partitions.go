@@ -0,0 +1,204 @@
+// internal/repository/partitions.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// partitionNameLayout is the time layout of monthly partition names, e.g. messages_p2024_05
+const partitionNameLayout = "messages_p2006_01"
+
+// Partition describes one monthly partition of the messages table
+type Partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// monthStart returns the first instant of the month containing t, in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// createPartition creates the partition covering month unless it already exists
+func createPartition(tx *sql.Tx, month time.Time) error {
+	name := month.Format(partitionNameLayout)
+
+	var exists bool
+	if err := tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	// Rows that arrived before the partition existed sit in the default partition and would
+	// overlap the new bounds, so they are moved out and re-inserted around the CREATE.
+	from := month.Format("2006-01-02")
+	to := month.AddDate(0, 1, 0).Format("2006-01-02")
+	_, err := tx.Exec(fmt.Sprintf(`
+	CREATE TEMP TABLE messages_moving AS
+		SELECT id, user_id, username, content, room_id, created_at, bot FROM messages_default
+		WHERE created_at >= '%[2]s' AND created_at < '%[3]s';
+	DELETE FROM messages_default WHERE created_at >= '%[2]s' AND created_at < '%[3]s';
+	CREATE TABLE %[1]s PARTITION OF messages FOR VALUES FROM ('%[2]s') TO ('%[3]s');
+	INSERT INTO messages (id, user_id, username, content, room_id, created_at, bot)
+		SELECT id, user_id, username, content, room_id, created_at, bot FROM messages_moving;
+	DROP TABLE messages_moving;
+	`, pq.QuoteIdentifier(name), from, to))
+	return err
+}
+
+// partitionDefaultRows creates the partitions for the months of the rows in the default
+// partition, such as imported history, which moves the rows into them
+func partitionDefaultRows(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT date_trunc('month', created_at) FROM messages_default")
+	if err != nil {
+		return err
+	}
+	var months []time.Time
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			rows.Close()
+			return err
+		}
+		months = append(months, monthStart(month))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, month := range months {
+		if err := createPartition(tx, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsurePartitions creates the partitions for the current month and the given number of
+// months ahead, and for the months of any rows that landed in the default partition
+func (r *Repository) EnsurePartitions(ctx context.Context, monthsAhead int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := partitionDefaultRows(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	current := monthStart(time.Now())
+	for i := 0; i <= monthsAhead; i++ {
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := createPartition(tx, current.AddDate(0, i, 0)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPartitions returns the monthly partitions of the messages table, oldest first
+func (r *Repository) ListPartitions(ctx context.Context) ([]Partition, error) {
+	query := `
+	SELECT c.relname
+	FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	JOIN pg_class p ON p.oid = i.inhparent
+	WHERE p.relname = 'messages'
+	ORDER BY c.relname
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		month, err := time.Parse(partitionNameLayout, name)
+		if err != nil {
+			// Not a monthly partition, e.g. messages_default
+			continue
+		}
+		partitions = append(partitions, Partition{
+			Name: name,
+			From: month,
+			To:   month.AddDate(0, 1, 0),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return partitions, nil
+}
+
+// DropPartition drops a monthly partition and returns the number of rows it held
+func (r *Repository) DropPartition(ctx context.Context, p Partition) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+pq.QuoteIdentifier(p.Name)).Scan(&count); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+pq.QuoteIdentifier(p.Name)); err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+// DropPartitionIfEmpty drops a monthly partition only if it holds no rows
+func (r *Repository) DropPartitionIfEmpty(ctx context.Context, p Partition) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the partition so no row can land in it between the check and the drop
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE "+pq.QuoteIdentifier(p.Name)+" IN ACCESS EXCLUSIVE MODE"); err != nil {
+		return false, err
+	}
+
+	var hasRows bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+pq.QuoteIdentifier(p.Name)+")").Scan(&hasRows); err != nil {
+		return false, err
+	}
+	if hasRows {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE "+pq.QuoteIdentifier(p.Name)); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -4,14 +4,19 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"github.com/afzalabbasi/message-service/persistence-service/internal/blobstore"
 	"github.com/afzalabbasi/message-service/persistence-service/internal/config"
 	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
 	_ "github.com/lib/pq"
+	"time"
 )
 
 // Repository handles database operations
 type Repository struct {
 	db *sql.DB
+
+	// Store holding archived history; nil when archiving is disabled
+	archive blobstore.Store
 }
 
 // NewRepository creates a new Repository
@@ -31,36 +36,193 @@ func NewRepository(cfg *config.Config) (*Repository, error) {
 		return nil, err
 	}
 
+	var archive blobstore.Store
+	if cfg.ArchiveURL != "" {
+		if archive, err = blobstore.Open(cfg.ArchiveURL); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Repository{
-		db: db,
+		db:      db,
+		archive: archive,
 	}, nil
 }
 
 // Initialize database tables
 func initDB(db *sql.DB) error {
-	query := `
+	// Databases created before partitioning was introduced hold messages in a plain table
+	legacy, err := isPlainTable(db, "messages")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return migrateToPartitioned(db)
+	}
+
+	_, err = db.Exec(schema)
+	return err
+}
+
+// schema creates the messages table, range partitioned by created_at, and its supporting tables.
+// Monthly partitions are created by EnsurePartitions; rows outside them land in messages_default.
+// The audit log is append-only: triggers reject changes, and its hash chain reveals any made around them.
+const schema = `
 	CREATE TABLE IF NOT EXISTS messages (
-		id VARCHAR(36) PRIMARY KEY,
+		id VARCHAR(36) NOT NULL,
 		user_id VARCHAR(36) NOT NULL,
 		username VARCHAR(50) NOT NULL,
 		content TEXT NOT NULL,
 		room_id VARCHAR(36) NOT NULL,
-		created_at TIMESTAMP NOT NULL
-	);
+		created_at TIMESTAMP NOT NULL,
+		bot BOOLEAN NOT NULL DEFAULT FALSE,
+		content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+		PRIMARY KEY (id, created_at)
+	) PARTITION BY RANGE (created_at);
+	CREATE TABLE IF NOT EXISTS messages_default PARTITION OF messages DEFAULT;
+	ALTER TABLE messages ADD COLUMN IF NOT EXISTS bot BOOLEAN NOT NULL DEFAULT FALSE;
 	CREATE INDEX IF NOT EXISTS idx_messages_room_id ON messages(room_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_user_id ON messages(user_id);
 	CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+	CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON messages USING GIN (content_tsv);
+
+	CREATE TABLE IF NOT EXISTS retention_policies (
+		room_id VARCHAR(36) PRIMARY KEY,
+		retain_days INTEGER NOT NULL CHECK (retain_days > 0),
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS message_archives (
+		id BIGSERIAL PRIMARY KEY,
+		room_id VARCHAR(36) NOT NULL,
+		object_key TEXT UNIQUE NOT NULL,
+		format VARCHAR(32) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		row_count INTEGER NOT NULL,
+		range_start TIMESTAMP NOT NULL,
+		range_end TIMESTAMP NOT NULL,
+		archived_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_archives_room_range ON message_archives(room_id, range_end);
+	ALTER TABLE message_archives ADD COLUMN IF NOT EXISTS authors_indexed BOOLEAN NOT NULL DEFAULT FALSE;
+
+	CREATE TABLE IF NOT EXISTS archive_authors (
+		user_id VARCHAR(36) NOT NULL,
+		archive_id BIGINT NOT NULL REFERENCES message_archives(id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, archive_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_archive_authors_archive_id ON archive_authors(archive_id);
+
+	CREATE TABLE IF NOT EXISTS user_erasures (
+		user_id VARCHAR(36) PRIMARY KEY,
+		event_id VARCHAR(36) NOT NULL,
+		policy VARCHAR(16) NOT NULL,
+		messages_affected BIGINT NOT NULL,
+		requested_at TIMESTAMP NOT NULL,
+		processed_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		seq BIGSERIAL PRIMARY KEY,
+		event_id VARCHAR(36) UNIQUE NOT NULL,
+		service VARCHAR(50) NOT NULL,
+		action VARCHAR(50) NOT NULL,
+		actor_id VARCHAR(36) NOT NULL DEFAULT '',
+		target_id VARCHAR(36) NOT NULL DEFAULT '',
+		room_id VARCHAR(36) NOT NULL DEFAULT '',
+		ip_address VARCHAR(45) NOT NULL DEFAULT '',
+		details JSONB NOT NULL DEFAULT '{}',
+		occurred_at TIMESTAMP NOT NULL,
+		recorded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		prev_hash CHAR(64) NOT NULL,
+		hash CHAR(64) NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id, occurred_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, occurred_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_occurred_at ON audit_log(occurred_at);
+
+	CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+	DROP TRIGGER IF EXISTS audit_log_no_change ON audit_log;
+	CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+	DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+	CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
 	`
-	_, err := db.Exec(query)
-	return err
+
+// isPlainTable reports whether name is an existing, non-partitioned table
+func isPlainTable(db *sql.DB, name string) (bool, error) {
+	var kind string
+	err := db.QueryRow(`
+	SELECT c.relkind FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relname = $1 AND n.nspname = current_schema()
+	`, name).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return kind == "r", nil
+}
+
+// migrateToPartitioned moves the rows of a plain messages table into the partitioned schema
+func migrateToPartitioned(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Free the table, constraint and index names for the partitioned table
+	_, err = tx.Exec(`
+	ALTER TABLE messages RENAME TO messages_unpartitioned;
+	ALTER TABLE messages_unpartitioned RENAME CONSTRAINT messages_pkey TO messages_unpartitioned_pkey;
+	DROP INDEX IF EXISTS idx_messages_room_id, idx_messages_user_id, idx_messages_created_at, idx_messages_content_tsv;
+	`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+
+	var oldest sql.NullTime
+	if err := tx.QueryRow("SELECT MIN(created_at) FROM messages_unpartitioned").Scan(&oldest); err != nil {
+		return err
+	}
+	if oldest.Valid {
+		for month := monthStart(oldest.Time); !month.After(time.Now()); month = month.AddDate(0, 1, 0) {
+			if err := createPartition(tx, month); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO messages (id, user_id, username, content, room_id, created_at)
+	SELECT id, user_id, username, content, room_id, created_at FROM messages_unpartitioned;
+	DROP TABLE messages_unpartitioned;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // SaveMessage saves a message to the database
 func (r *Repository) SaveMessage(ctx context.Context, message models.Message) error {
 	query := `
-	INSERT INTO messages (id, user_id, username, content, room_id, created_at)
-	VALUES ($1, $2, $3, $4, $5, $6)
-	ON CONFLICT (id) DO NOTHING
+	INSERT INTO messages (id, user_id, username, content, room_id, created_at, bot)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id, created_at) DO NOTHING
 	`
 	_, err := r.db.ExecContext(
 		ctx,
@@ -71,14 +233,16 @@ func (r *Repository) SaveMessage(ctx context.Context, message models.Message) er
 		message.Content,
 		message.RoomID,
 		message.CreatedAt,
+		message.Bot,
 	)
 	return err
 }
 
-// GetMessagesByRoom retrieves messages for a specific room
+// GetMessagesByRoom retrieves messages for a specific room, newest first.
+// Pages that reach past the hot table continue into the room's archived history.
 func (r *Repository) GetMessagesByRoom(ctx context.Context, roomID string, limit, offset int) ([]models.Message, error) {
 	query := `
-	SELECT id, user_id, username, content, room_id, created_at
+	SELECT id, user_id, username, content, room_id, created_at, bot
 	FROM messages
 	WHERE room_id = $1
 	ORDER BY created_at DESC
@@ -100,6 +264,7 @@ func (r *Repository) GetMessagesByRoom(ctx context.Context, roomID string, limit
 			&msg.Content,
 			&msg.RoomID,
 			&msg.CreatedAt,
+			&msg.Bot,
 		); err != nil {
 			return nil, err
 		}
@@ -110,7 +275,28 @@ func (r *Repository) GetMessagesByRoom(ctx context.Context, roomID string, limit
 		return nil, err
 	}
 
-	return messages, nil
+	if r.archive == nil || len(messages) == limit {
+		return messages, nil
+	}
+
+	// Work out how many archived messages the offset still has to skip
+	hotCount := offset + len(messages)
+	if len(messages) == 0 && offset > 0 {
+		if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM messages WHERE room_id = $1", roomID).Scan(&hotCount); err != nil {
+			return nil, err
+		}
+	}
+	archiveOffset := offset - hotCount
+	if archiveOffset < 0 {
+		archiveOffset = 0
+	}
+
+	archived, err := r.getArchivedMessages(ctx, roomID, limit-len(messages), archiveOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(messages, archived...), nil
 }
 
 // Close closes the database connection
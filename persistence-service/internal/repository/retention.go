@@ -0,0 +1,100 @@
+// internal/repository/retention.go
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+)
+
+// purgeBatchSize bounds the rows removed per DELETE so purges never hold long locks
+const purgeBatchSize = 5000
+
+// SetRetentionPolicy sets how many days messages in a room are kept, overriding the global rule
+func (r *Repository) SetRetentionPolicy(ctx context.Context, roomID string, retainDays int) error {
+	query := `
+	INSERT INTO retention_policies (room_id, retain_days, updated_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (room_id) DO UPDATE SET retain_days = EXCLUDED.retain_days, updated_at = NOW()
+	`
+	_, err := r.db.ExecContext(ctx, query, roomID, retainDays)
+	return err
+}
+
+// DeleteRetentionPolicy removes a room's retention policy so the global rule applies again
+func (r *Repository) DeleteRetentionPolicy(ctx context.Context, roomID string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM retention_policies WHERE room_id = $1", roomID)
+	return err
+}
+
+// ListRetentionPolicies returns all per-room retention policies
+func (r *Repository) ListRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT room_id, retain_days, updated_at FROM retention_policies ORDER BY room_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []models.RetentionPolicy
+	for rows.Next() {
+		var p models.RetentionPolicy
+		if err := rows.Scan(&p.RoomID, &p.RetainDays, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// PurgeByRoomPolicies deletes messages older than their room's retention policy allows
+func (r *Repository) PurgeByRoomPolicies(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+	DELETE FROM messages WHERE (id, created_at) IN (
+		SELECT m.id, m.created_at
+		FROM messages m
+		JOIN retention_policies p ON p.room_id = m.room_id
+		WHERE m.created_at < $1::timestamp - p.retain_days * INTERVAL '1 day'
+		LIMIT $2
+	)
+	`
+	return r.purgeInBatches(ctx, query, now)
+}
+
+// PurgeOlderThan deletes messages created before cutoff in rooms without their own retention policy
+func (r *Repository) PurgeOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+	DELETE FROM messages WHERE (id, created_at) IN (
+		SELECT m.id, m.created_at
+		FROM messages m
+		WHERE m.created_at < $1
+		AND NOT EXISTS (SELECT 1 FROM retention_policies p WHERE p.room_id = m.room_id)
+		LIMIT $2
+	)
+	`
+	return r.purgeInBatches(ctx, query, cutoff)
+}
+
+// purgeInBatches runs a batched DELETE until it stops matching rows and returns the total removed
+func (r *Repository) purgeInBatches(ctx context.Context, query string, arg time.Time) (int64, error) {
+	var total int64
+	for {
+		res, err := r.db.ExecContext(ctx, query, arg, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
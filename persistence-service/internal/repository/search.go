@@ -0,0 +1,130 @@
+// internal/repository/search.go
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// headlineOptions controls how matched terms are marked up in search snippets
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// escapedContent is the message content HTML-escaped, so that the only markup in a
+// highlight is the marking of matched terms. The text search parser skips the entities.
+const escapedContent = `replace(replace(replace(replace(replace(m.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// searchConditions returns the WHERE conditions of a search and their arguments, after
+// the tsquery in $1
+func searchConditions(q models.SearchQuery) ([]string, []interface{}) {
+	args := []interface{}{q.Query}
+	conditions := []string{"m.content_tsv @@ q.query"}
+
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if q.RoomID != "" {
+		addCondition("m.room_id = $%d", q.RoomID)
+	}
+	if q.UserID != "" {
+		addCondition("m.user_id = $%d", q.UserID)
+	}
+	if q.From != nil {
+		addCondition("m.created_at >= $%d", *q.From)
+	}
+	if q.To != nil {
+		addCondition("m.created_at < $%d", *q.To)
+	}
+	return conditions, args
+}
+
+// SearchRooms returns the rooms with messages matching a search, most recently active
+// first, up to limit rooms
+func (r *Repository) SearchRooms(ctx context.Context, q models.SearchQuery, limit int) ([]string, error) {
+	conditions, args := searchConditions(q)
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+	SELECT m.room_id
+	FROM messages m, websearch_to_tsquery('english', $1) AS q(query)
+	WHERE %s
+	GROUP BY m.room_id
+	ORDER BY MAX(m.created_at) DESC
+	LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []string
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, roomID)
+	}
+	return rooms, rows.Err()
+}
+
+// SearchMessages runs a ranked full-text search over message content in the given rooms,
+// or in all rooms if rooms is nil
+func (r *Repository) SearchMessages(ctx context.Context, rooms []string, q models.SearchQuery) ([]models.SearchResult, error) {
+	if rooms != nil && len(rooms) == 0 {
+		return []models.SearchResult{}, nil
+	}
+
+	conditions, args := searchConditions(q)
+	if rooms != nil {
+		args = append(args, pq.Array(rooms))
+		conditions = append(conditions, fmt.Sprintf("m.room_id = ANY($%d)", len(args)))
+	}
+
+	args = append(args, q.Limit, q.Offset)
+	query := fmt.Sprintf(`
+	SELECT m.id, m.user_id, m.username, m.content, m.room_id, m.created_at, m.bot,
+		ts_rank_cd(m.content_tsv, q.query) AS rank,
+		ts_headline('english', %s, q.query, '%s') AS highlight
+	FROM messages m, websearch_to_tsquery('english', $1) AS q(query)
+	WHERE %s
+	ORDER BY rank DESC, m.created_at DESC
+	LIMIT $%d OFFSET $%d
+	`, escapedContent, headlineOptions, strings.Join(conditions, " AND "), len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+		if err := rows.Scan(
+			&res.ID,
+			&res.UserID,
+			&res.Username,
+			&res.Content,
+			&res.RoomID,
+			&res.CreatedAt,
+			&res.Bot,
+			&res.Rank,
+			&res.Highlight,
+		); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
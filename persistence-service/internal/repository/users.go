@@ -0,0 +1,255 @@
+// internal/repository/users.go
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/afzalabbasi/message-service/persistence-service/internal/models"
+)
+
+// User deletion policies
+const (
+	DeletionPolicyAnonymize = "anonymize"
+	DeletionPolicyErase     = "erase"
+)
+
+// ForgetUser applies the deletion policy to every message a deleted user wrote, in the hot
+// table and in the archive, and records the erasure, all in one transaction. Only archived
+// objects that hold the user's messages are rewritten. Replaying an event that was already
+// applied is a no-op, so it is safe to consume user_deleted events at least once.
+func (r *Repository) ForgetUser(ctx context.Context, event models.UserEvent, policy string) (int64, error) {
+	if policy != DeletionPolicyAnonymize && policy != DeletionPolicyErase {
+		return 0, fmt.Errorf("unknown deletion policy %q", policy)
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// Runs once the transaction has ended, so the archive locks outlast it
+	rewrite := &archiveRewrite{conn: conn, locks: make(map[string]func())}
+	committed := false
+	defer func() { r.finishRewrite(rewrite, committed) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rewrite.tx = tx
+
+	var processed bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_erasures WHERE user_id = $1)", event.UserID).Scan(&processed)
+	if err != nil {
+		return 0, err
+	}
+	if processed {
+		return 0, nil
+	}
+
+	var res sql.Result
+	if policy == DeletionPolicyAnonymize {
+		res, err = tx.ExecContext(ctx,
+			"UPDATE messages SET user_id = $2, username = $3 WHERE user_id = $1",
+			event.UserID, models.DeletedUserID, models.DeletedUsername)
+	} else {
+		res, err = tx.ExecContext(ctx, "DELETE FROM messages WHERE user_id = $1", event.UserID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if r.archive != nil {
+		err := r.rewriteUserArchives(ctx, rewrite, event.UserID, func(msg *models.Message) bool {
+			if msg.UserID != event.UserID {
+				return true
+			}
+			affected++
+			if policy == DeletionPolicyErase {
+				return false
+			}
+			msg.UserID = models.DeletedUserID
+			msg.Username = models.DeletedUsername
+			return true
+		})
+		if err != nil {
+			return affected, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO user_erasures (user_id, event_id, policy, messages_affected, requested_at, processed_at)
+	VALUES ($1, $2, $3, $4, $5, NOW())
+	ON CONFLICT (user_id) DO NOTHING
+	`, event.UserID, event.EventID, policy, affected, event.Timestamp)
+	if err != nil {
+		return affected, err
+	}
+	if err := tx.Commit(); err != nil {
+		return affected, err
+	}
+	committed = true
+
+	if n := len(rewrite.replaced); n > 0 {
+		log.Printf("Rewrote %d archive objects for deleted user %s", n, event.UserID)
+	}
+	return affected, nil
+}
+
+// RenameUser updates the denormalized username of a user's messages. Archived messages keep
+// the name they were written under.
+func (r *Repository) RenameUser(ctx context.Context, userID, username string) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE messages SET username = $2 WHERE user_id = $1 AND username <> $2", userID, username)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// archiveRewrite is the state of archive rewrites made in a transaction: the archive locks
+// held until it ends, and the objects written for it and replaced by it
+type archiveRewrite struct {
+	conn     *sql.Conn
+	tx       *sql.Tx
+	locks    map[string]func()
+	created  []string
+	replaced []string
+}
+
+// finishRewrite releases the locks of a rewrite and removes the objects no manifest refers
+// to: the replaced ones if the transaction committed, and the new ones otherwise
+func (r *Repository) finishRewrite(w *archiveRewrite, committed bool) {
+	orphaned := w.created
+	if committed {
+		orphaned = w.replaced
+	}
+	for _, key := range orphaned {
+		r.deleteObject(key)
+	}
+	for _, unlock := range w.locks {
+		unlock()
+	}
+}
+
+// rewriteUserArchives passes every archived message of the objects a user wrote in, and of
+// objects archived before authors were indexed, to fn, which may modify it in place and
+// returns false to drop it. Each room and month is locked against archiving until the
+// rewrite's transaction ends, so a merge cannot bring back what the rewrite removed.
+func (r *Repository) rewriteUserArchives(ctx context.Context, w *archiveRewrite, userID string, fn func(msg *models.Message) bool) error {
+	const columns = "id, room_id, object_key, format, checksum, row_count, range_start, range_end, archived_at"
+	const holdsUser = "(NOT authors_indexed OR id IN (SELECT archive_id FROM archive_authors WHERE user_id = $1))"
+
+	candidates, err := scanManifests(w.tx.QueryContext(ctx,
+		"SELECT "+columns+" FROM message_archives WHERE "+holdsUser+" ORDER BY room_id, range_start", userID))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range candidates {
+		month := archiveMonth(c.RangeStart)
+		lockKey := c.RoomID + "/" + month.Format("2006-01")
+		if _, ok := w.locks[lockKey]; ok {
+			continue
+		}
+		unlock, err := lockArchiveMonth(ctx, w.conn, c.RoomID, month)
+		if err != nil {
+			return err
+		}
+		w.locks[lockKey] = unlock
+
+		// Read the month again under the lock; archiving may have merged its objects since
+		manifests, err := scanManifests(w.tx.QueryContext(ctx,
+			"SELECT "+columns+" FROM message_archives WHERE "+holdsUser+" AND room_id = $2 AND range_start >= $3 AND range_start < $4",
+			userID, c.RoomID, month, month.AddDate(0, 1, 0)))
+		if err != nil {
+			return err
+		}
+		for _, m := range manifests {
+			if err := r.rewriteArchive(ctx, w, m, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteArchive passes the messages of an archived object to fn as rewriteUserArchives
+// does. An object whose contents change is replaced by a new object, or removed if nothing
+// is left of it; either way its authors are indexed again.
+func (r *Repository) rewriteArchive(ctx context.Context, w *archiveRewrite, m models.ArchiveManifest, fn func(msg *models.Message) bool) error {
+	messages, err := r.readArchive(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	kept := messages[:0]
+	authors := make(map[string]bool)
+	for _, msg := range messages {
+		orig := msg
+		if !fn(&msg) {
+			changed = true
+			continue
+		}
+		if msg != orig {
+			changed = true
+		}
+		kept = append(kept, msg)
+		authors[msg.UserID] = true
+	}
+
+	if !changed {
+		userIDs := make([]string, 0, len(authors))
+		for userID := range authors {
+			userIDs = append(userIDs, userID)
+		}
+		return indexArchiveAuthors(ctx, w.tx, m.ID, userIDs)
+	}
+
+	if len(kept) == 0 {
+		if _, err := w.tx.ExecContext(ctx, "DELETE FROM message_archives WHERE id = $1", m.ID); err != nil {
+			return err
+		}
+		w.replaced = append(w.replaced, m.ObjectKey)
+		return nil
+	}
+
+	replacement := m
+	replacement.ObjectKey = archiveKey(m.RoomID, m.RangeStart)
+	err = r.putArchive(ctx, &replacement, func(emit func(models.Message) error) error {
+		for _, msg := range kept {
+			if err := emit(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.created = append(w.created, replacement.ObjectKey)
+
+	_, err = w.tx.ExecContext(ctx, `
+	UPDATE message_archives
+	SET object_key = $2, checksum = $3, row_count = $4, range_start = $5, range_end = $6
+	WHERE id = $1
+	`, m.ID, replacement.ObjectKey, replacement.Checksum, replacement.RowCount, replacement.RangeStart, replacement.RangeEnd)
+	if err != nil {
+		return err
+	}
+	if err := indexArchiveAuthors(ctx, w.tx, m.ID, replacement.UserIDs); err != nil {
+		return err
+	}
+	w.replaced = append(w.replaced, m.ObjectKey)
+	return nil
+}
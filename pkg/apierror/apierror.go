@@ -0,0 +1,127 @@
+// apierror/apierror.go
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Error codes shared by all services. Services add their own, more specific codes; clients
+// should treat codes they do not know by the HTTP status alone.
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeValidationFailed  = "validation_failed"
+	CodeUnauthorized      = "unauthorized"
+	CodeInvalidToken      = "invalid_token"
+	CodeTokenRevoked      = "token_revoked"
+	CodeForbidden         = "forbidden"
+	CodeInsufficientScope = "insufficient_scope"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeConflict          = "conflict"
+	CodeRateLimited       = "rate_limited"
+	CodeInternal          = "internal_error"
+)
+
+// Response is the JSON body of every error response
+type Response struct {
+	Error Body `json:"error"`
+}
+
+// Body describes an error
+type Body struct {
+	Code      string `json:"code"`                 // machine-readable, stable across releases
+	Message   string `json:"message"`              // human-readable, may change
+	RequestID string `json:"request_id,omitempty"` // set when the request went through chi's RequestID middleware
+
+	// Set on validation_failed errors, one entry per invalid field
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why the value of a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Write sends an error response with the given status, code and message
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	write(w, r, status, Body{Code: code, Message: message})
+}
+
+// WriteFields sends a 400 validation_failed response listing the invalid fields
+func WriteFields(w http.ResponseWriter, r *http.Request, fields []FieldError) {
+	write(w, r, http.StatusBadRequest, Body{
+		Code:    CodeValidationFailed,
+		Message: "One or more fields are invalid",
+		Fields:  fields,
+	})
+}
+
+// write sends an error response with the given body, adding the request ID
+func write(w http.ResponseWriter, r *http.Request, status int, body Body) {
+	requestID := middleware.GetReqID(r.Context())
+	if requestID != "" {
+		w.Header().Set(middleware.RequestIDHeader, requestID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	body.RequestID = requestID
+	json.NewEncoder(w).Encode(Response{Error: body})
+}
+
+// Mapping maps an error, and every error wrapping it, to an HTTP response
+type Mapping struct {
+	Err     error
+	Status  int
+	Code    string
+	Message string // sent instead of the error's own text if set
+}
+
+// Table maps service errors to HTTP responses; the first mapping that matches wins
+type Table []Mapping
+
+// Lookup returns the mapping of err
+func (t Table) Lookup(err error) (Mapping, bool) {
+	for _, m := range t {
+		if errors.Is(err, m.Err) {
+			return m, true
+		}
+	}
+	return Mapping{}, false
+}
+
+// WriteError sends the response err maps to. Errors without a mapping are logged with the
+// request ID and answered with a 500 carrying the fallback message, so internal details
+// never reach the client.
+func (t Table) WriteError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	m, ok := t.Lookup(err)
+	if !ok {
+		log.Printf("[%s] %s %s: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, err)
+		Write(w, r, http.StatusInternalServerError, CodeInternal, fallback)
+		return
+	}
+
+	message := m.Message
+	if message == "" {
+		message = m.Err.Error()
+	}
+	Write(w, r, m.Status, m.Code, message)
+}
+
+// NotFound answers requests for unknown routes; use it as the router's NotFound handler
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+}
+
+// MethodNotAllowed answers requests with a method the route does not support; use it as
+// the router's MethodNotAllowed handler
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
@@ -0,0 +1,51 @@
+// auth/claims.go
+package auth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Claims defines the claims of access tokens issued by the auth service
+type Claims struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+
+	// Global roles of the user, e.g. "admin"
+	Roles []string `json:"roles,omitempty"`
+
+	// Login session, i.e. refresh token family, a user token was issued to
+	SessionID string `json:"sid,omitempty"`
+
+	// Set on machine tokens issued to service clients, whose UserID is the client ID;
+	// Scopes lists what the token may be used for
+	Bot    bool     `json:"bot,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+
+	jwt.RegisteredClaims
+}
+
+// contextKey is the type of keys stored in request contexts by this package
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated caller's claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims stored by NewContext
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// HasRole reports whether the token carries the global role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// auth/client.go
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A token is renewed this long before it expires, or halfway through its lifetime if that
+// is sooner
+const tokenRenewMargin = 30 * time.Second
+
+// ErrNoClientCredentials is returned when a service has no service client configured
+var ErrNoClientCredentials = errors.New("no service client credentials configured")
+
+// ClientCredentials obtains machine tokens for a service client from the auth service
+// with the client credentials grant, and reuses each token until shortly before it expires
+type ClientCredentials struct {
+	url      string
+	clientID string
+	secret   string
+	scopes   []string
+	client   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	renews time.Time
+}
+
+// NewClientCredentials creates a token source for a service client of the auth service
+// at authServiceURL, requesting the given scopes
+func NewClientCredentials(authServiceURL, clientID, secret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		url:      authServiceURL + "/oauth/token",
+		clientID: clientID,
+		secret:   secret,
+		scopes:   scopes,
+		client:   &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+// Token returns a machine token, fetching a new one when the current one is due for renewal
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	if c.clientID == "" || c.secret == "" {
+		return "", ErrNoClientCredentials
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.renews) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.secret)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching service client token: unexpected status %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("fetching service client token: no access token in response")
+	}
+
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	margin := tokenRenewMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+	c.token = token.AccessToken
+	c.renews = time.Now().Add(lifetime - margin)
+	return c.token, nil
+}
+
+// Authorize sets the Authorization header of req to a machine token
+func (c *ClientCredentials) Authorize(req *http.Request) error {
+	token, err := c.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,222 @@
+// auth/jwks.go
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// How long fetched keys are used before the set is fetched again
+	cacheTTL = 5 * time.Minute
+
+	// Minimum time between fetches triggered by unknown key IDs
+	minRefreshInterval = 10 * time.Second
+
+	// Time allowed to fetch the key set
+	fetchTimeout = 5 * time.Second
+)
+
+// key is a public key from the auth service's key set
+type key struct {
+	alg    string
+	public crypto.PublicKey
+}
+
+// JWKSCache verifies tokens with the public keys published by the auth service.
+// Keys are refetched when they are stale or a token names an unknown key, which is how
+// rotated keys are picked up.
+type JWKSCache struct {
+	url    string
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]key
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	fetching    chan struct{} // closed when the fetch in progress, if any, is over
+}
+
+// NewJWKSCache creates a key cache for the auth service at authServiceURL
+func NewJWKSCache(authServiceURL string) *JWKSCache {
+	return NewJWKSCacheURL(authServiceURL + "/.well-known/jwks.json")
+}
+
+// NewJWKSCacheURL creates a key cache for the key set at jwksURL, e.g. one published by
+// an external identity provider
+func NewJWKSCacheURL(jwksURL string) *JWKSCache {
+	return &JWKSCache{
+		url:    jwksURL,
+		client: &http.Client{Timeout: fetchTimeout},
+		keys:   make(map[string]key),
+	}
+}
+
+// Keyfunc returns the key that verifies a token, selected by its kid header.
+// It is meant to be used as VerifierConfig.Keys.
+func (c *JWKSCache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no key ID")
+	}
+
+	k, err := c.get(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+// get returns the key with the given ID. Stale keys stay in use while the set is refetched
+// in the background, so an unreachable auth service does not hold up verification; only
+// unknown keys wait for the fetch. Fetches are at least minRefreshInterval apart and only
+// one runs at a time.
+func (c *JWKSCache) get(kid string) (key, error) {
+	c.mu.Lock()
+	k, ok := c.keys[kid]
+	if ok && time.Since(c.fetchedAt) <= cacheTTL {
+		c.mu.Unlock()
+		return k, nil
+	}
+	done := c.fetching
+	if done == nil && time.Since(c.lastAttempt) >= minRefreshInterval {
+		done = c.startRefreshLocked()
+	}
+	c.mu.Unlock()
+
+	if !ok && done != nil {
+		<-done
+		c.mu.Lock()
+		k, ok = c.keys[kid]
+		c.mu.Unlock()
+	}
+	if !ok {
+		return key{}, fmt.Errorf("unknown key %q", kid)
+	}
+	return k, nil
+}
+
+// startRefreshLocked fetches the key set in the background and returns a channel that is
+// closed when the fetch is over; c.mu must be held
+func (c *JWKSCache) startRefreshLocked() chan struct{} {
+	done := make(chan struct{})
+	c.fetching = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+		if err := c.Refresh(ctx); err != nil {
+			// Keep verifying with the keys we have if the auth service is unreachable
+			log.Printf("Error fetching JWKS: %v", err)
+		}
+
+		c.mu.Lock()
+		c.fetching = nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// Refresh fetches the key set. The keys fetched last stay in use if it fails.
+func (c *JWKSCache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	c.lastAttempt = time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// fetch downloads and parses the key set
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType   string `json:"kty"`
+			KeyID     string `json:"kid"`
+			Use       string `json:"use"`
+			Algorithm string `json:"alg"`
+			N         string `json:"n"`
+			E         string `json:"e"`
+			Curve     string `json:"crv"`
+			X         string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+
+		// alg is optional; some identity providers leave it out of their RSA keys
+		if jwk.KeyType == "RSA" && jwk.Algorithm == "" {
+			jwk.Algorithm = jwt.SigningMethodRS256.Alg()
+		}
+
+		var public crypto.PublicKey
+		switch {
+		case jwk.KeyType == "RSA" && jwk.Algorithm == jwt.SigningMethodRS256.Alg():
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", jwk.KeyID, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", jwk.KeyID, err)
+			}
+			public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519" && jwk.Algorithm == jwt.SigningMethodEdDSA.Alg():
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %s: invalid Ed25519 key", jwk.KeyID)
+			}
+			public = ed25519.PublicKey(x)
+		default:
+			log.Printf("Skipping unsupported JWK %s (%s %s)", jwk.KeyID, jwk.KeyType, jwk.Algorithm)
+			continue
+		}
+		keys[jwk.KeyID] = key{alg: jwk.Algorithm, public: public}
+	}
+
+	return keys, nil
+}
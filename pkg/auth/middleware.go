@@ -0,0 +1,53 @@
+// auth/middleware.go
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+)
+
+// Middleware authenticates requests by their bearer token and stores the caller's claims
+// in the request context, see FromContext
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization header required")
+			return
+		}
+
+		token, ok := BearerToken(r)
+		if !ok {
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization header must be in the format 'Bearer {token}'")
+			return
+		}
+
+		claims, err := v.VerifyContext(r.Context(), token)
+		switch {
+		case errors.Is(err, ErrTokenRevoked):
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeTokenRevoked, "Token has been revoked")
+			return
+		case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired):
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
+			return
+		case err != nil:
+			log.Printf("Error verifying token: %v", err)
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// BearerToken returns the token of the request's bearer Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	tokenParts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return "", false
+	}
+	return tokenParts[1], true
+}
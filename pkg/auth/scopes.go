@@ -0,0 +1,60 @@
+// auth/scopes.go
+package auth
+
+import (
+	"net/http"
+
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+)
+
+// Scopes that can be granted to machine tokens
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeRoomsAdmin    = "rooms:admin"
+)
+
+// KnownScopes lists every scope the services enforce
+var KnownScopes = []string{ScopeMessagesRead, ScopeMessagesWrite, ScopeRoomsAdmin}
+
+// IsKnownScope reports whether scope is one of KnownScopes
+func IsKnownScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was explicitly granted scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the token may be used for scope. Scopes only restrict machine
+// tokens; user tokens are limited by what the user may do instead.
+func (c *Claims) Allows(scope string) bool {
+	return !c.Bot || c.HasScope(scope)
+}
+
+// RequireScope returns middleware rejecting tokens that do not allow scope. It must run
+// after Middleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := FromContext(r.Context())
+			if !ok || !claims.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				apierror.Write(w, r, http.StatusForbidden, apierror.CodeInsufficientScope, "Insufficient scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// auth/verifier.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Errors returned by Verify
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// KeyFunc returns the public key that verifies an asymmetrically signed token
+type KeyFunc func(token *jwt.Token) (interface{}, error)
+
+// VerifierConfig configures a Verifier
+type VerifierConfig struct {
+	// Keys resolves the keys of RS256 and EdDSA tokens, e.g. JWKSCache.Keyfunc
+	Keys KeyFunc
+
+	// Expected iss and aud claims
+	Issuer   string
+	Audience string
+
+	// Allowed clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+}
+
+// Verifier verifies access tokens issued by the auth service
+type Verifier struct {
+	config VerifierConfig
+	parser *jwt.Parser
+
+	// IsRevoked, if set, is consulted for every otherwise valid token
+	IsRevoked func(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// NewVerifier creates a new Verifier
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	methods := []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+	return &Verifier{
+		config: cfg,
+		// Claims are validated by Verify, which allows for clock skew
+		parser: jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithoutClaimsValidation()),
+	}
+}
+
+// Verify checks a token's signature, algorithm, issuer, audience and lifetime and
+// returns its claims
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-v.config.Leeway), true) {
+		return nil, ErrTokenExpired
+	}
+	if !claims.VerifyNotBefore(now.Add(v.config.Leeway), false) || !claims.VerifyIssuedAt(now.Add(v.config.Leeway), false) {
+		return nil, fmt.Errorf("%w: token used before issued", ErrInvalidToken)
+	}
+	if v.config.Issuer != "" && !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.config.Audience != "" && !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience %v", ErrInvalidToken, claims.Audience)
+	}
+
+	return claims, nil
+}
+
+// VerifyContext is Verify followed by the IsRevoked check
+func (v *Verifier) VerifyContext(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := v.Verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.IsRevoked != nil {
+		revoked, err := v.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// keyFunc selects the verification key for a token's algorithm
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if v.config.Keys == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return v.config.Keys(token)
+}
@@ -0,0 +1,189 @@
+// authz/authorizer.go
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+const (
+	// How long resolved room roles are used; role changes take effect within this time
+	accessCacheTTL = 30 * time.Second
+
+	// Time allowed to resolve a room role
+	resolveTimeout = 5 * time.Second
+)
+
+// MaxAccessBatch is the most rooms whose roles the auth service resolves in one request
+const MaxAccessBatch = 200
+
+// cachedAccess is a resolved room role and when it was resolved
+type cachedAccess struct {
+	access     RoomAccess
+	resolvedAt time.Time
+}
+
+// Authorizer checks permissions in rooms, resolving callers' room roles with the auth
+// service and caching them briefly
+type Authorizer struct {
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedAccess
+}
+
+// NewAuthorizer creates an Authorizer for the auth service at authServiceURL
+func NewAuthorizer(authServiceURL string) *Authorizer {
+	return &Authorizer{
+		url:    authServiceURL,
+		client: &http.Client{Timeout: resolveTimeout},
+		cache:  make(map[string]cachedAccess),
+	}
+}
+
+// Check reports whether the caller has perm in a room. token is the caller's access token,
+// which the auth service requires to look up the caller's role.
+func (a *Authorizer) Check(ctx context.Context, claims *auth.Claims, token, roomID string, perm Permission) (bool, error) {
+	access, err := a.Access(ctx, claims, token, roomID)
+	if err != nil {
+		return false, err
+	}
+	return Can(claims, access, perm), nil
+}
+
+// Access returns the caller's role in a room
+func (a *Authorizer) Access(ctx context.Context, claims *auth.Claims, token, roomID string) (RoomAccess, error) {
+	key := roomID + "\x00" + claims.UserID
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && time.Since(cached.resolvedAt) < accessCacheTTL {
+		return cached.access, nil
+	}
+
+	access, err := a.resolve(ctx, token, roomID)
+	if err != nil {
+		return RoomAccess{}, err
+	}
+
+	a.store(access)
+	return access, nil
+}
+
+// AccessMany returns the caller's role in each of several rooms, keyed by room ID. Roles
+// that are not cached are resolved in as few requests to the auth service as possible.
+func (a *Authorizer) AccessMany(ctx context.Context, claims *auth.Claims, token string, roomIDs []string) (map[string]RoomAccess, error) {
+	accesses := make(map[string]RoomAccess, len(roomIDs))
+	var missing []string
+
+	a.mu.Lock()
+	for _, roomID := range roomIDs {
+		cached, ok := a.cache[roomID+"\x00"+claims.UserID]
+		if ok && time.Since(cached.resolvedAt) < accessCacheTTL {
+			accesses[roomID] = cached.access
+		} else {
+			missing = append(missing, roomID)
+		}
+	}
+	a.mu.Unlock()
+
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > MaxAccessBatch {
+			batch = batch[:MaxAccessBatch]
+		}
+		missing = missing[len(batch):]
+
+		resolved, err := a.resolveMany(ctx, token, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, access := range resolved {
+			accesses[access.RoomID] = access
+			a.store(access)
+		}
+	}
+	return accesses, nil
+}
+
+// store caches a resolved room role
+func (a *Authorizer) store(access RoomAccess) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Drop stale entries now and then so the cache does not grow without bound
+	if len(a.cache) > 10000 {
+		for k, v := range a.cache {
+			if time.Since(v.resolvedAt) >= accessCacheTTL {
+				delete(a.cache, k)
+			}
+		}
+	}
+	a.cache[access.RoomID+"\x00"+access.UserID] = cachedAccess{access: access, resolvedAt: time.Now()}
+}
+
+// resolve asks the auth service for the caller's role in a room
+func (a *Authorizer) resolve(ctx context.Context, token, roomID string) (RoomAccess, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url+"/rooms/"+url.PathEscape(roomID)+"/roles/me", nil)
+	if err != nil {
+		return RoomAccess{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return RoomAccess{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return RoomAccess{}, fmt.Errorf("resolving room role: unexpected status %s", resp.Status)
+	}
+
+	var access RoomAccess
+	if err := json.NewDecoder(resp.Body).Decode(&access); err != nil {
+		return RoomAccess{}, err
+	}
+	return access, nil
+}
+
+// resolveMany asks the auth service for the caller's roles in several rooms at once
+func (a *Authorizer) resolveMany(ctx context.Context, token string, roomIDs []string) ([]RoomAccess, error) {
+	body, err := json.Marshal(map[string][]string{"room_ids": roomIDs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url+"/me/room-roles", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resolving room roles: unexpected status %s", resp.Status)
+	}
+
+	var result struct {
+		Rooms []RoomAccess `json:"rooms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Rooms, nil
+}
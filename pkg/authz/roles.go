@@ -0,0 +1,122 @@
+// authz/roles.go
+package authz
+
+import (
+	"time"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// Global roles, carried in the roles claim of access tokens
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Room roles, resolved per request; see Authorizer
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Permission is something a caller may be allowed to do in a room
+type Permission string
+
+// Permissions checked by the services
+const (
+	PermReadMessages    Permission = "read_messages"
+	PermPostMessages    Permission = "post_messages"
+	PermModerateRoom    Permission = "moderate_room"
+	PermManageRoomRoles Permission = "manage_room_roles"
+)
+
+// rolePermissions lists the permissions of each room role
+var rolePermissions = map[string][]Permission{
+	RoleOwner:     {PermReadMessages, PermPostMessages, PermModerateRoom, PermManageRoomRoles},
+	RoleModerator: {PermReadMessages, PermPostMessages, PermModerateRoom},
+	RoleMember:    {PermReadMessages, PermPostMessages},
+}
+
+// permissionScopes is the scope a machine token needs for each permission
+var permissionScopes = map[Permission]string{
+	PermReadMessages:    auth.ScopeMessagesRead,
+	PermPostMessages:    auth.ScopeMessagesWrite,
+	PermModerateRoom:    auth.ScopeRoomsAdmin,
+	PermManageRoomRoles: auth.ScopeRoomsAdmin,
+}
+
+// IsGlobalRole reports whether role is a valid global role
+func IsGlobalRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser
+}
+
+// IsRoomRole reports whether role is a valid room role
+func IsRoomRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoomAccess is a caller's role and standing in a room. Rooms without any role
+// assignments are unmanaged and open to everyone, as all rooms were before roles existed.
+type RoomAccess struct {
+	RoomID  string `json:"room_id"`
+	UserID  string `json:"user_id"`
+	Role    string `json:"role,omitempty"`
+	Managed bool   `json:"managed"`
+
+	// Set while the caller is banned from or muted in the room
+	Banned     bool       `json:"banned,omitempty"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// Muted reports whether the caller is currently muted in the room
+func (a RoomAccess) Muted() bool {
+	return a.MutedUntil != nil && time.Now().Before(*a.MutedUntil)
+}
+
+// Can reports whether the caller with the given claims and access to a room has perm.
+// Admins may do anything. Banned callers may do nothing in the room and muted ones may
+// not post. Machine tokens also need the matching scope, and rooms:admin stands in for a
+// room role.
+func Can(claims *auth.Claims, access RoomAccess, perm Permission) bool {
+	if !claims.Bot && claims.HasRole(RoleAdmin) {
+		return true
+	}
+	if access.Banned || (perm == PermPostMessages && access.Muted()) {
+		return false
+	}
+
+	if claims.Bot {
+		if !claims.HasScope(permissionScopes[perm]) {
+			return false
+		}
+		if claims.HasScope(auth.ScopeRoomsAdmin) {
+			return true
+		}
+	}
+
+	role := access.Role
+	if role == "" && !access.Managed {
+		role = RoleMember
+	}
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleRank orders room roles by authority; callers without a role rank lowest
+func RoleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+module github.com/afzalabbasi/message-service/pkg
+
+go 1.24.2
+
+require github.com/golang-jwt/jwt/v4 v4.5.2
+
+require github.com/go-chi/chi/v5 v5.2.1
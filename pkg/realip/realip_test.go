@@ -0,0 +1,70 @@
+// realip/realip_test.go
+package realip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7:4000"},
+		{"spoofed forwarded for", "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7:4000"},
+		{"spoofed real ip", "203.0.113.7:4000", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7:4000"},
+		{"trusted proxy", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"client prepends a hop", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "192.0.2.9, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.6"}, "198.51.100.1"},
+		{"malformed hop", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "nonsense"}, "10.0.0.5:4000"},
+		{"trusted proxy real ip", "10.0.0.5:4000", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := Middleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8, 192.0.2.1, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::1/128"}
+	if len(networks) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(networks), len(want))
+	}
+	for i, network := range networks {
+		if network.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, network, want[i])
+		}
+	}
+
+	if _, err := ParseNetworks("10.0.0.0/8,nonsense"); err == nil {
+		t.Error("malformed network: got no error")
+	}
+}
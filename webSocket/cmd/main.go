@@ -3,6 +3,9 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
 	"github.com/afzalabbasi/message-service/webSocket/internal/api"
 	"github.com/afzalabbasi/message-service/webSocket/internal/config"
 	kafka "github.com/afzalabbasi/message-service/webSocket/internal/kakfa"
@@ -14,6 +17,9 @@ import (
 	"time"
 )
 
+// Longest wait between attempts to load the revocation and sanction lists at startup
+const maxLoadRetryDelay = 30 * time.Second
+
 func main() {
 	// Load configuration
 	cfg, err := config.Load()
@@ -34,6 +40,12 @@ func main() {
 	}
 	defer kafkaProducer.Close()
 
+	userEventConsumer, err := kafka.NewUserEventConsumer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create user event consumer: %v", err)
+	}
+	defer userEventConsumer.Close()
+
 	// Initialize WebSocket hub
 	hub := api.NewHub(kafkaProducer)
 	go hub.Run()
@@ -45,8 +57,50 @@ func main() {
 		}
 	}()
 
+	// Drop the sessions of deleted users and revoked tokens in a goroutine
+	go func() {
+		if err := userEventConsumer.Consume(hub); err != nil {
+			log.Fatalf("Failed to consume user events: %v", err)
+		}
+	}()
+
+	// Catch up on revocations and room sanctions made before this replica started; later
+	// ones arrive as events. The auth service only lists them to service clients. Until
+	// both lists are loaded the server does not listen, so the replica stays unready
+	// rather than accept revoked tokens and banned users.
+	credentials := auth.NewClientCredentials(cfg.AuthServiceURL, cfg.ServiceClientID, cfg.ServiceClientSecret, auth.ScopeRoomsAdmin)
+	for attempt := 1; ; attempt++ {
+		err := loadEnforcementLists(hub, cfg.AuthServiceURL, credentials)
+		if err == nil {
+			break
+		}
+		delay := time.Duration(attempt) * time.Second
+		if delay > maxLoadRetryDelay {
+			delay = maxLoadRetryDelay
+		}
+		log.Printf("Failed to load revocations and room sanctions, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+	}
+
+	// Verify tokens with the auth service's published keys; unknown keys are fetched on demand
+	keys := auth.NewJWKSCache(cfg.AuthServiceURL)
+	keysCtx, keysCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := keys.Refresh(keysCtx); err != nil {
+		log.Printf("Failed to fetch token verification keys: %v", err)
+	}
+	keysCancel()
+	verifier := auth.NewVerifier(auth.VerifierConfig{
+		Keys:     keys.Keyfunc,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Leeway:   cfg.JWTLeeway,
+	})
+	verifier.IsRevoked = hub.IsTokenRevoked
+
 	// Initialize HTTP handler
-	handler := api.NewHandler(hub, cfg)
+	// Room roles are resolved with the auth service when clients connect or post
+	authorizer := authz.NewAuthorizer(cfg.AuthServiceURL)
+	handler := api.NewHandler(hub, cfg, verifier, authorizer, credentials)
 
 	// Configure server
 	server := &http.Server{
@@ -81,3 +135,17 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
+// loadEnforcementLists loads the token revocations and room sanctions in effect
+func loadEnforcementLists(hub *api.Hub, authServiceURL string, credentials *auth.ClientCredentials) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := hub.LoadRevocations(ctx, authServiceURL, credentials); err != nil {
+		return fmt.Errorf("loading token revocations: %v", err)
+	}
+	if err := hub.LoadSanctions(ctx, authServiceURL, credentials); err != nil {
+		return fmt.Errorf("loading room sanctions: %v", err)
+	}
+	return nil
+}
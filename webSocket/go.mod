@@ -4,13 +4,17 @@ go 1.24.2
 
 require (
 	github.com/go-chi/chi/v5 v5.2.1
-	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/segmentio/kafka-go v0.4.47
 )
 
+require github.com/golang-jwt/jwt/v4 v4.5.2 // indirect
+
 require (
+	github.com/afzalabbasi/message-service/pkg v0.0.0
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 )
+
+replace github.com/afzalabbasi/message-service/pkg => ../pkg
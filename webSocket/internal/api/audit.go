@@ -0,0 +1,45 @@
+// internal/api/audit.go
+package api
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/afzalabbasi/message-service/webSocket/internal/models"
+	"github.com/google/uuid"
+)
+
+// audit publishes an event to the audit log. A failed publish is logged; it must not
+// change the outcome of what is being audited.
+func (h *Hub) audit(ctx context.Context, event models.AuditEvent) {
+	event.EventID = uuid.New().String()
+	event.Service = models.AuditService
+	event.Timestamp = time.Now()
+	if err := h.kafkaProducer.PublishAuditEvent(ctx, event); err != nil {
+		log.Printf("Error publishing %s audit event: %v", event.Action, err)
+	}
+}
+
+// auditRejection records a refused connection to a room; userID is empty if the caller
+// could not be authenticated
+func (h *Handler) auditRejection(r *http.Request, userID, roomID, reason string) {
+	h.hub.audit(r.Context(), models.AuditEvent{
+		Action:    models.AuditConnectionRejected,
+		ActorID:   userID,
+		RoomID:    roomID,
+		IPAddress: clientIP(r),
+		Details:   map[string]string{"reason": reason},
+	})
+}
+
+// clientIP returns the client's IP address; realip.Middleware has already applied the
+// headers of trusted proxies
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
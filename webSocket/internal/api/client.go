@@ -3,9 +3,13 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
 	"github.com/afzalabbasi/message-service/webSocket/internal/models"
 
 	"log"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,14 +30,41 @@ const (
 	maxMessageSize = 4096
 )
 
+// Client frame types; frames without a type are chat messages
+const (
+	frameTypeMessage = "message"
+	frameTypeReauth  = "reauth"
+
+	// Sent first on connections opened without credentials
+	frameTypeAuth = "auth"
+)
+
+// authProtocol is offered in the Sec-WebSocket-Protocol header, followed by the access token
+// as a second entry; the server selects it and the token is never echoed back
+const authProtocol = "message-service.bearer"
+
 // Client represents a WebSocket client
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan models.Message
-	roomID   string
-	userID   string
-	username string
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan models.Message
+	roomID string
+	userID string
+
+	// Set for service clients, whose messages are marked as sent by a bot
+	bot bool
+
+	// Username attached to outgoing messages; updated when the user is renamed
+	username atomic.Value
+
+	// The client's current access token claims; replaced by reauth frames
+	claims atomic.Pointer[auth.Claims]
+
+	// Whether the client may post to the room; re-checked on reauth
+	canPost atomic.Bool
+
+	// Validates tokens presented in reauth frames and resolves the caller's room access
+	authorize func(token string) (*auth.Claims, authz.RoomAccess, error)
 }
 
 // readPump pumps messages from the WebSocket connection to the hub
@@ -61,21 +92,45 @@ func (c *Client) readPump() {
 
 		// Parse message content
 		var messageContent struct {
+			Type    string `json:"type"`
 			Content string `json:"content"`
+			Token   string `json:"token"`
 		}
 		if err := json.Unmarshal(data, &messageContent); err != nil {
 			log.Printf("error unmarshaling message: %v", err)
 			continue
 		}
 
+		switch messageContent.Type {
+		case "", frameTypeMessage:
+			if !c.canPost.Load() {
+				c.closeWithReason(websocket.ClosePolicyViolation, "not allowed to post")
+				return
+			}
+			if until, muted := c.hub.MutedUntil(c.roomID, c.userID); muted {
+				c.notify("you are muted in this room until " + until.UTC().Format(time.RFC3339))
+				continue
+			}
+		case frameTypeReauth:
+			if !c.reauthenticate(messageContent.Token) {
+				c.closeWithReason(websocket.ClosePolicyViolation, "invalid token or access revoked")
+				return
+			}
+			continue
+		default:
+			log.Printf("unknown frame type from %s: %q", c.userID, messageContent.Type)
+			continue
+		}
+
 		// Create a new message
 		message := models.Message{
 			ID:        uuid.New().String(),
 			UserID:    c.userID,
-			Username:  c.username,
+			Username:  c.username.Load().(string),
 			Content:   messageContent.Content,
 			RoomID:    c.roomID,
 			CreatedAt: time.Now(),
+			Bot:       c.bot,
 		}
 
 		// Publish message to Kafka
@@ -85,6 +140,59 @@ func (c *Client) readPump() {
 	}
 }
 
+// reauthenticate extends the session with a fresh access token for the same user, as long
+// as the user may still read the room
+func (c *Client) reauthenticate(token string) bool {
+	claims, access, err := c.authorize(token)
+	if err != nil || claims.UserID != c.userID || claims.Bot != c.bot {
+		return false
+	}
+	if !authz.Can(claims, access, authz.PermReadMessages) {
+		return false
+	}
+	c.claims.Store(claims)
+	c.canPost.Store(authz.Can(claims, access, authz.PermPostMessages))
+	return true
+}
+
+// notify sends an error notice to this client only; it is dropped if the send buffer is full
+func (c *Client) notify(content string) {
+	notice := models.Message{
+		ID:        uuid.New().String(),
+		Content:   content,
+		RoomID:    c.roomID,
+		CreatedAt: time.Now(),
+		Type:      "error",
+	}
+	select {
+	case c.send <- notice:
+	default:
+	}
+}
+
+// tokenExpiry returns the Unix time at which a token expires; tokens without exp never do
+func tokenExpiry(claims *auth.Claims) int64 {
+	if claims.ExpiresAt == nil {
+		return math.MaxInt64
+	}
+	return claims.ExpiresAt.Unix()
+}
+
+// closeWithReason sends a close frame with the given code and reason and closes the connection.
+// It is safe to call concurrently with the pumps; readPump then unregisters the client.
+func (c *Client) closeWithReason(code int, reason string) {
+	closeConn(c.conn, code, reason)
+}
+
+// closeConn sends a close frame with the given code and reason and closes the connection
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait)); err != nil {
+		log.Printf("error sending close frame to %s: %v", conn.RemoteAddr(), err)
+	}
+	conn.Close()
+}
+
 // writePump pumps messages from the hub to the WebSocket connection
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
@@ -120,6 +228,12 @@ func (c *Client) writePump() {
 			}
 
 		case <-ticker.C:
+			// The token expired without the client sending a reauth frame
+			if time.Now().Unix() >= tokenExpiry(c.claims.Load()) {
+				c.closeWithReason(websocket.ClosePolicyViolation, "token expired")
+				return
+			}
+
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
@@ -2,42 +2,64 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/afzalabbasi/message-service/pkg/apierror"
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+	"github.com/afzalabbasi/message-service/pkg/realip"
 	"github.com/afzalabbasi/message-service/webSocket/internal/config"
 	"github.com/afzalabbasi/message-service/webSocket/internal/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
-// JWTClaims defines the JWT claims structure
-type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	jwt.RegisteredClaims
-}
+// Error codes specific to the WebSocket service; see apierror for the shared ones
+const (
+	CodeBanned = "banned"
+	CodeMuted  = "muted"
+)
+
+// Time allowed for a request to the auth service made while a connection is being opened
+const authRequestTimeout = 5 * time.Second
 
 // Handler handles HTTP requests for the WebSocket service
 type Handler struct {
-	hub      *Hub
-	config   *config.Config
-	upgrader websocket.Upgrader
+	hub         *Hub
+	config      *config.Config
+	verifier    *auth.Verifier
+	authorizer  *authz.Authorizer
+	credentials *auth.ClientCredentials
+	client      *http.Client
+	upgrader    websocket.Upgrader
 }
 
 // NewHandler creates a new Handler
-func NewHandler(hub *Hub, cfg *config.Config) *Handler {
+func NewHandler(hub *Hub, cfg *config.Config, verifier *auth.Verifier, authorizer *authz.Authorizer, credentials *auth.ClientCredentials) *Handler {
 	return &Handler{
-		hub:    hub,
-		config: cfg,
+		hub:         hub,
+		config:      cfg,
+		verifier:    verifier,
+		authorizer:  authorizer,
+		credentials: credentials,
+		client:      &http.Client{Timeout: authRequestTimeout},
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins in development; restrict in production
 			},
+			Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+				apierror.Write(w, r, status, apierror.CodeInvalidRequest, reason.Error())
+			},
+			Subprotocols: []string{authProtocol},
 		},
 	}
 }
@@ -50,51 +72,98 @@ func (h *Handler) SetupRoutes() http.Handler {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realip.Middleware(h.config.TrustedProxies))
+	r.NotFound(apierror.NotFound)
+	r.MethodNotAllowed(apierror.MethodNotAllowed)
 
 	// Routes
 	r.Get("/ws/{roomID}", h.handleWebSocket)
 	r.Get("/health", h.healthCheck)
 
+	// Protected routes, mainly for bots that post without keeping a connection open
+	r.Group(func(r chi.Router) {
+		r.Use(h.verifier.Middleware)
+		r.With(auth.RequireScope(auth.ScopeMessagesWrite)).Post("/rooms/{roomID}/messages", h.postMessage)
+	})
+
 	return r
 }
 
-// validateToken validates a JWT token
-func (h *Handler) validateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(h.config.JWTSecret), nil
-	})
-
+// validateToken validates a JWT token and checks it against the revocation list
+func (h *Handler) validateToken(tokenString string) (*auth.Claims, error) {
+	claims, err := h.verifier.Verify(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	if h.hub.revocations.IsRevoked(claims) {
+		return nil, auth.ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// authorize validates a token and resolves the caller's access to a room
+func (h *Handler) authorize(ctx context.Context, tokenString, roomID string) (*auth.Claims, authz.RoomAccess, error) {
+	claims, err := h.validateToken(tokenString)
+	if err != nil {
+		return nil, authz.RoomAccess{}, err
 	}
 
-	return nil, jwt.ErrSignatureInvalid
+	access, err := h.authorizer.Access(ctx, claims, tokenString, roomID)
+	if err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+	return claims, access, nil
 }
 
-// handleWebSocket handles WebSocket connections
+// handleWebSocket handles WebSocket connections. Callers authenticate with a connection
+// ticket (?ticket=), a token in the Sec-WebSocket-Protocol header after authProtocol, a
+// token query parameter if allowed, or else an auth frame sent right after the upgrade.
 func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	roomID := chi.URLParam(r, "roomID")
 	if roomID == "" {
-		http.Error(w, "Room ID is required", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Room ID is required")
 		return
 	}
 
-	// Get token from query param
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "Authentication token is required", http.StatusUnauthorized)
+	var claims *auth.Claims
+	var access authz.RoomAccess
+	var err error
+	ticket, headerToken, token := r.URL.Query().Get("ticket"), protocolToken(r), r.URL.Query().Get("token")
+	switch {
+	case ticket != "":
+		claims, access, err = h.redeemTicket(r.Context(), ticket, roomID)
+	case headerToken != "":
+		claims, access, err = h.authorize(r.Context(), headerToken, roomID)
+	case token != "" && !h.config.AllowQueryToken:
+		apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized,
+			"Token query parameter is disabled; use a ticket or the "+authProtocol+" subprotocol")
+		return
+	case token != "":
+		claims, access, err = h.authorize(r.Context(), token, roomID)
+	default:
+		h.awaitAuthFrame(w, r, roomID)
 		return
 	}
-
-	// Validate token
-	claims, err := h.validateToken(token)
 	if err != nil {
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		if isCredentialError(err) {
+			h.auditRejection(r, "", roomID, "invalid_token")
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
+			return
+		}
+		log.Printf("Error resolving access to room %s: %v", roomID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check permissions")
+		return
+	}
+
+	if reason := h.denyReason(claims, access, roomID); reason != "" {
+		h.auditRejection(r, claims.UserID, roomID, reason)
+		if reason == rejectBanned {
+			apierror.Write(w, r, http.StatusForbidden, CodeBanned, "Banned from this room")
+		} else {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Access to room denied")
+		}
 		return
 	}
 
@@ -105,15 +174,91 @@ func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create a new client
+	h.startClient(conn, roomID, claims, access)
+}
+
+// awaitAuthFrame upgrades a connection opened without credentials and waits for an auth
+// frame carrying the caller's token before admitting it to the room
+func (h *Handler) awaitAuthFrame(w http.ResponseWriter, r *http.Request, roomID string) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(h.config.AuthTimeout))
+	var frame struct {
+		Type  string `json:"type"`
+		Token string `json:"token"`
+	}
+	if err := conn.ReadJSON(&frame); err != nil || frame.Type != frameTypeAuth || frame.Token == "" {
+		closeConn(conn, websocket.ClosePolicyViolation, "expected auth frame")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), writeWait)
+	claims, access, err := h.authorize(ctx, frame.Token, roomID)
+	cancel()
+	if err != nil {
+		if isCredentialError(err) {
+			h.auditRejection(r, "", roomID, "invalid_token")
+			closeConn(conn, websocket.ClosePolicyViolation, "invalid or expired token")
+			return
+		}
+		log.Printf("Error resolving access to room %s: %v", roomID, err)
+		closeConn(conn, websocket.CloseInternalServerErr, "failed to check permissions")
+		return
+	}
+
+	if reason := h.denyReason(claims, access, roomID); reason != "" {
+		h.auditRejection(r, claims.UserID, roomID, reason)
+		closeConn(conn, websocket.ClosePolicyViolation, reason)
+		return
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	h.startClient(conn, roomID, claims, access)
+}
+
+// Reasons a caller with valid credentials is refused a connection to a room
+const (
+	rejectForbidden = "forbidden"
+	rejectBanned    = "banned"
+)
+
+// denyReason returns why a caller may not join a room, or "" if they may. Connections
+// receive the room's messages; sending needs permission to post as well.
+func (h *Handler) denyReason(claims *auth.Claims, access authz.RoomAccess, roomID string) string {
+	if !authz.Can(claims, access, authz.PermReadMessages) {
+		return rejectForbidden
+	}
+	// Bans reach this replica over Kafka before the authorizer's cache expires
+	if h.hub.IsBanned(roomID, claims.UserID) {
+		return rejectBanned
+	}
+	return ""
+}
+
+// startClient registers an admitted connection with the hub and starts its pumps
+func (h *Handler) startClient(conn *websocket.Conn, roomID string, claims *auth.Claims, access authz.RoomAccess) {
 	client := &Client{
-		hub:      h.hub,
-		conn:     conn,
-		send:     make(chan models.Message, 256),
-		roomID:   roomID,
-		userID:   claims.UserID,
-		username: claims.Username,
+		hub:    h.hub,
+		conn:   conn,
+		send:   make(chan models.Message, 256),
+		roomID: roomID,
+		userID: claims.UserID,
+		bot:    claims.Bot,
+
+		authorize: func(token string) (*auth.Claims, authz.RoomAccess, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), writeWait)
+			defer cancel()
+			return h.authorize(ctx, token, roomID)
+		},
 	}
+	client.claims.Store(claims)
+	client.canPost.Store(authz.Can(claims, access, authz.PermPostMessages))
+	client.username.Store(claims.Username)
 
 	// Register client with hub
 	h.hub.register <- client
@@ -123,6 +268,82 @@ func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go client.readPump()
 }
 
+// protocolToken returns the token offered in the Sec-WebSocket-Protocol header as the
+// subprotocol following authProtocol, which browsers can set where they cannot set headers
+func protocolToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == authProtocol {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// isCredentialError reports whether err means the caller's token or ticket was not accepted,
+// as opposed to a failure to check it
+func isCredentialError(err error) bool {
+	return errors.Is(err, ErrInvalidTicket) || errors.Is(err, auth.ErrInvalidToken) ||
+		errors.Is(err, auth.ErrTokenExpired) || errors.Is(err, auth.ErrTokenRevoked)
+}
+
+// postMessage publishes a message to a room
+func (h *Handler) postMessage(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	token, _ := auth.BearerToken(r)
+	allowed, err := h.authorizer.Check(r.Context(), claims, token, roomID, authz.PermPostMessages)
+	if err != nil {
+		log.Printf("Error resolving access of %s to room %s: %v", claims.UserID, roomID, err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check permissions")
+		return
+	}
+	if !allowed {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "Not allowed to post in this room")
+		return
+	}
+	if h.hub.IsBanned(roomID, claims.UserID) {
+		apierror.Write(w, r, http.StatusForbidden, CodeBanned, "Banned from this room")
+		return
+	}
+	if _, muted := h.hub.MutedUntil(roomID, claims.UserID); muted {
+		apierror.Write(w, r, http.StatusForbidden, CodeMuted, "Muted in this room")
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize)).Decode(&req); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if req.Content == "" {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "Content is required")
+		return
+	}
+
+	message := models.Message{
+		ID:        uuid.New().String(),
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Content:   req.Content,
+		RoomID:    roomID,
+		CreatedAt: time.Now(),
+		Bot:       claims.Bot,
+	}
+	if err := h.hub.PublishMessage(message); err != nil {
+		log.Printf("Error publishing message: %v", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "Failed to send message")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
 // healthCheck handles health checks
 func (h *Handler) healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
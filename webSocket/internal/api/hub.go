@@ -2,10 +2,15 @@
 package api
 
 import (
+	"context"
+	"github.com/afzalabbasi/message-service/pkg/auth"
 	kafka "github.com/afzalabbasi/message-service/webSocket/internal/kakfa"
 	"github.com/afzalabbasi/message-service/webSocket/internal/models"
+	"github.com/gorilla/websocket"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Hub maintains active clients and broadcasts messages
@@ -22,6 +27,12 @@ type Hub struct {
 	// Kafka producer for publishing messages
 	kafkaProducer *kafka.Producer
 
+	// Revoked tokens, rejected on connect and reauth
+	revocations *RevocationList
+
+	// Room bans and mutes; banned users are rejected on connect, muted users may not post
+	sanctions *SanctionList
+
 	// Mutex for thread-safe access to clients map
 	mu sync.RWMutex
 }
@@ -33,6 +44,8 @@ func NewHub(kafkaProducer *kafka.Producer) *Hub {
 		register:      make(chan *Client),
 		unregister:    make(chan *Client),
 		kafkaProducer: kafkaProducer,
+		revocations:   NewRevocationList(),
+		sanctions:     NewSanctionList(),
 	}
 }
 
@@ -89,6 +102,171 @@ func (h *Hub) Broadcast(message models.Message, roomID string) {
 	h.mu.RUnlock()
 }
 
+// DisconnectUser closes every connection held by a user, in every room
+func (h *Hub) DisconnectUser(userID, reason string) {
+	closeClients(h.clientsWhere(func(roomID string, client *Client) bool {
+		return client.userID == userID
+	}), reason)
+}
+
+// RenameUser changes the username attached to messages sent by a user's connections
+func (h *Hub) RenameUser(userID, username string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, clients := range h.clients {
+		for client := range clients {
+			if client.userID == userID {
+				client.username.Store(username)
+			}
+		}
+	}
+}
+
+// RevokeToken revokes a single token and closes the connections that use it
+func (h *Hub) RevokeToken(tokenID string, expiresAt time.Time) {
+	h.revocations.RevokeToken(tokenID, expiresAt)
+	h.closeRevoked()
+}
+
+// RevokeUserTokens revokes a user's tokens issued before the given time and closes the
+// connections that use them
+func (h *Hub) RevokeUserTokens(userID string, before time.Time) {
+	h.revocations.RevokeUserTokens(userID, before)
+	h.closeRevoked()
+}
+
+// RevokeSession revokes the tokens of a login session and closes the connections that use them
+func (h *Hub) RevokeSession(sessionID string, expiresAt time.Time) {
+	h.revocations.RevokeSession(sessionID, expiresAt)
+	h.closeRevoked()
+}
+
+// LoadRevocations fetches the revocations made before this replica started
+func (h *Hub) LoadRevocations(ctx context.Context, authServiceURL string, credentials *auth.ClientCredentials) error {
+	if err := h.revocations.Load(ctx, authServiceURL, credentials); err != nil {
+		return err
+	}
+	h.closeRevoked()
+	return nil
+}
+
+// IsTokenRevoked reports whether a token is on the revocation list. It is meant to be
+// used as the verifier's IsRevoked hook.
+func (h *Hub) IsTokenRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	return h.revocations.IsRevoked(claims), nil
+}
+
+// closeRevoked closes every connection whose current token is revoked
+func (h *Hub) closeRevoked() {
+	closed := h.clientsWhere(func(roomID string, client *Client) bool {
+		return h.revocations.IsRevoked(client.claims.Load())
+	})
+	closeClients(closed, "token revoked")
+
+	for _, client := range closed {
+		claims := client.claims.Load()
+		h.audit(context.Background(), models.AuditEvent{
+			Action:  models.AuditConnectionRevoked,
+			ActorID: client.userID,
+			RoomID:  client.roomID,
+			Details: map[string]string{"token_id": claims.ID, "session_id": claims.SessionID},
+		})
+	}
+}
+
+// KickUser closes a user's connections to a room; they may reconnect
+func (h *Hub) KickUser(roomID, userID, reason string) {
+	h.closeRoomUser(roomID, userID, moderationCloseReason("kicked", reason))
+}
+
+// BanUser bans a user from a room until the given time, or for good if it is zero, and
+// closes their connections to it
+func (h *Hub) BanUser(roomID, userID string, until time.Time, reason string) {
+	h.sanctions.Ban(roomID, userID, until)
+	h.closeRoomUser(roomID, userID, moderationCloseReason("banned", reason))
+}
+
+// UnbanUser lifts a user's ban from a room
+func (h *Hub) UnbanUser(roomID, userID string) {
+	h.sanctions.Unban(roomID, userID)
+}
+
+// MuteUser keeps a user from posting in a room until the given time
+func (h *Hub) MuteUser(roomID, userID string, until time.Time) {
+	h.sanctions.Mute(roomID, userID, until)
+}
+
+// UnmuteUser lifts a user's mute in a room
+func (h *Hub) UnmuteUser(roomID, userID string) {
+	h.sanctions.Unmute(roomID, userID)
+}
+
+// IsBanned reports whether a user is banned from a room
+func (h *Hub) IsBanned(roomID, userID string) bool {
+	return h.sanctions.IsBanned(roomID, userID)
+}
+
+// MutedUntil returns when a user's mute in a room ends, and whether they are muted
+func (h *Hub) MutedUntil(roomID, userID string) (time.Time, bool) {
+	return h.sanctions.MutedUntil(roomID, userID)
+}
+
+// LoadSanctions fetches the bans and mutes made before this replica started
+func (h *Hub) LoadSanctions(ctx context.Context, authServiceURL string, credentials *auth.ClientCredentials) error {
+	if err := h.sanctions.Load(ctx, authServiceURL, credentials); err != nil {
+		return err
+	}
+
+	closeClients(h.clientsWhere(func(roomID string, client *Client) bool {
+		return h.sanctions.IsBanned(roomID, client.userID)
+	}), "banned")
+	return nil
+}
+
+// closeRoomUser closes every connection a user holds to a room
+func (h *Hub) closeRoomUser(roomID, userID, reason string) {
+	closeClients(h.clientsWhere(func(room string, client *Client) bool {
+		return room == roomID && client.userID == userID
+	}), reason)
+}
+
+// clientsWhere returns the connected clients that match. Callers close them after the hub
+// lock is released, since sending a close frame can block for up to writeWait.
+func (h *Hub) clientsWhere(match func(roomID string, client *Client) bool) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var matched []*Client
+	for roomID, clients := range h.clients {
+		for client := range clients {
+			if match(roomID, client) {
+				matched = append(matched, client)
+			}
+		}
+	}
+	return matched
+}
+
+// closeClients closes the connections of clients with a policy violation and the reason
+func closeClients(clients []*Client, reason string) {
+	for _, client := range clients {
+		client.closeWithReason(websocket.ClosePolicyViolation, reason)
+	}
+}
+
+// moderationCloseReason builds the close frame reason for a kick or ban, which must fit
+// in the 123 bytes a control frame leaves for it
+func moderationCloseReason(action, reason string) string {
+	if reason == "" {
+		return action
+	}
+	msg := action + ": " + reason
+	if len(msg) > 123 {
+		msg = strings.ToValidUTF8(msg[:123], "")
+	}
+	return msg
+}
+
 // PublishMessage publishes a message to Kafka
 func (h *Hub) PublishMessage(message models.Message) error {
 	return h.kafkaProducer.PublishMessage(message)
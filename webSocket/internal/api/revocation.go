@@ -0,0 +1,143 @@
+// internal/api/revocation.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// RevocationList is the local copy of the auth service's revoked tokens
+type RevocationList struct {
+	mu sync.RWMutex
+
+	// Revoked token IDs and when the tokens expire
+	tokens map[string]time.Time
+
+	// Users whose tokens issued before the given time are revoked
+	users map[string]time.Time
+
+	// Revoked session IDs and when the last token issued to the session expires
+	sessions map[string]time.Time
+}
+
+// NewRevocationList creates an empty revocation list
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		tokens:   make(map[string]time.Time),
+		users:    make(map[string]time.Time),
+		sessions: make(map[string]time.Time),
+	}
+}
+
+// RevokeToken adds a single token to the list
+func (l *RevocationList) RevokeToken(tokenID string, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens[tokenID] = expiresAt
+	l.prune()
+}
+
+// RevokeUserTokens revokes every token of a user issued before the given time
+func (l *RevocationList) RevokeUserTokens(userID string, before time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if before.After(l.users[userID]) {
+		l.users[userID] = before
+	}
+}
+
+// RevokeSession revokes every token issued to a login session
+func (l *RevocationList) RevokeSession(sessionID string, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessions[sessionID] = expiresAt
+	l.prune()
+}
+
+// IsRevoked reports whether a token has been revoked
+func (l *RevocationList) IsRevoked(claims *auth.Claims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if claims.ID != "" {
+		if _, ok := l.tokens[claims.ID]; ok {
+			return true
+		}
+	}
+
+	if claims.SessionID != "" {
+		if _, ok := l.sessions[claims.SessionID]; ok {
+			return true
+		}
+	}
+
+	before, ok := l.users[claims.UserID]
+	if !ok {
+		return false
+	}
+	// Tokens without iat cannot prove they were issued after the revocation. iat has second
+	// precision while before is exact, so tokens from earlier in the revocation's second are caught.
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(before)
+}
+
+// prune drops revocations of tokens that have expired on their own; l.mu must be held
+func (l *RevocationList) prune() {
+	now := time.Now()
+	for id, expiresAt := range l.tokens {
+		if expiresAt.Before(now) {
+			delete(l.tokens, id)
+		}
+	}
+	for id, expiresAt := range l.sessions {
+		if expiresAt.Before(now) {
+			delete(l.sessions, id)
+		}
+	}
+}
+
+// Load fetches the active revocations from the auth service and merges them into the list
+func (l *RevocationList) Load(ctx context.Context, authServiceURL string, credentials *auth.ClientCredentials) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authServiceURL+"/revocations", nil)
+	if err != nil {
+		return err
+	}
+	if err := credentials.Authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var revocations struct {
+		Tokens   map[string]time.Time `json:"tokens"`
+		Users    map[string]time.Time `json:"users"`
+		Sessions map[string]time.Time `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&revocations); err != nil {
+		return err
+	}
+
+	for id, expiresAt := range revocations.Tokens {
+		l.RevokeToken(id, expiresAt)
+	}
+	for userID, before := range revocations.Users {
+		l.RevokeUserTokens(userID, before)
+	}
+	for id, expiresAt := range revocations.Sessions {
+		l.RevokeSession(id, expiresAt)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// internal/api/sanctions.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+)
+
+// SanctionList is the local copy of the bans and mutes in effect in rooms
+type SanctionList struct {
+	mu sync.RWMutex
+
+	// Banned and muted users by room, and when their ban or mute ends; bans ending at
+	// the zero time are permanent
+	bans  map[string]map[string]time.Time
+	mutes map[string]map[string]time.Time
+}
+
+// NewSanctionList creates an empty sanction list
+func NewSanctionList() *SanctionList {
+	return &SanctionList{
+		bans:  make(map[string]map[string]time.Time),
+		mutes: make(map[string]map[string]time.Time),
+	}
+}
+
+// Ban bans a user from a room until the given time, or for good if it is zero
+func (l *SanctionList) Ban(roomID, userID string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	set(l.bans, roomID, userID, until)
+	l.prune()
+}
+
+// Unban lifts a user's ban from a room
+func (l *SanctionList) Unban(roomID, userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unset(l.bans, roomID, userID)
+}
+
+// Mute keeps a user from posting in a room until the given time
+func (l *SanctionList) Mute(roomID, userID string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	set(l.mutes, roomID, userID, until)
+	l.prune()
+}
+
+// Unmute lifts a user's mute in a room
+func (l *SanctionList) Unmute(roomID, userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unset(l.mutes, roomID, userID)
+}
+
+// IsBanned reports whether a user is banned from a room
+func (l *SanctionList) IsBanned(roomID, userID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	until, ok := l.bans[roomID][userID]
+	return ok && (until.IsZero() || time.Now().Before(until))
+}
+
+// MutedUntil returns when a user's mute in a room ends, and whether they are muted
+func (l *SanctionList) MutedUntil(roomID, userID string) (time.Time, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	until, ok := l.mutes[roomID][userID]
+	return until, ok && time.Now().Before(until)
+}
+
+// prune drops bans and mutes that have ended; l.mu must be held
+func (l *SanctionList) prune() {
+	now := time.Now()
+	for _, sanctions := range []map[string]map[string]time.Time{l.bans, l.mutes} {
+		for roomID, users := range sanctions {
+			for userID, until := range users {
+				if !until.IsZero() && until.Before(now) {
+					delete(users, userID)
+				}
+			}
+			if len(users) == 0 {
+				delete(sanctions, roomID)
+			}
+		}
+	}
+}
+
+// Load fetches the bans and mutes in effect from the auth service and merges them into the list
+func (l *SanctionList) Load(ctx context.Context, authServiceURL string, credentials *auth.ClientCredentials) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authServiceURL+"/sanctions", nil)
+	if err != nil {
+		return err
+	}
+	if err := credentials.Authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var sanctions []struct {
+		RoomID    string     `json:"room_id"`
+		UserID    string     `json:"user_id"`
+		Kind      string     `json:"kind"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sanctions); err != nil {
+		return err
+	}
+
+	for _, s := range sanctions {
+		var until time.Time
+		if s.ExpiresAt != nil {
+			until = *s.ExpiresAt
+		}
+		switch s.Kind {
+		case "ban":
+			l.Ban(s.RoomID, s.UserID, until)
+		case "mute":
+			l.Mute(s.RoomID, s.UserID, until)
+		}
+	}
+	return nil
+}
+
+// set records a sanction in m
+func set(m map[string]map[string]time.Time, roomID, userID string, until time.Time) {
+	if m[roomID] == nil {
+		m[roomID] = make(map[string]time.Time)
+	}
+	m[roomID][userID] = until
+}
+
+// unset removes a sanction from m
+func unset(m map[string]map[string]time.Time, roomID, userID string) {
+	delete(m[roomID], userID)
+	if len(m[roomID]) == 0 {
+		delete(m, roomID)
+	}
+}
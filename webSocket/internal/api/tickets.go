@@ -0,0 +1,65 @@
+// internal/api/tickets.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/afzalabbasi/message-service/pkg/auth"
+	"github.com/afzalabbasi/message-service/pkg/authz"
+)
+
+// ErrInvalidTicket is returned for connection tickets the auth service does not accept
+var ErrInvalidTicket = errors.New("invalid connection ticket")
+
+// redeemTicket uses up a connection ticket with the auth service, as the service client,
+// and returns the claims of the token it was issued for, along with the caller's access to the room
+func (h *Handler) redeemTicket(ctx context.Context, ticket, roomID string) (*auth.Claims, authz.RoomAccess, error) {
+	body, err := json.Marshal(map[string]string{"ticket": ticket, "room_id": roomID})
+	if err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.AuthServiceURL+"/ws-tickets/redeem", bytes.NewReader(body))
+	if err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := h.credentials.Authorize(req); err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, authz.RoomAccess{}, ErrInvalidTicket
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, authz.RoomAccess{}, fmt.Errorf("redeeming ticket: unexpected status %s", resp.Status)
+	}
+
+	var redeemed struct {
+		Claims *auth.Claims     `json:"claims"`
+		Access authz.RoomAccess `json:"access"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&redeemed); err != nil {
+		return nil, authz.RoomAccess{}, err
+	}
+	if redeemed.Claims == nil {
+		return nil, authz.RoomAccess{}, ErrInvalidTicket
+	}
+
+	// Checked against this replica's revocation list like tokens presented directly
+	if h.hub.revocations.IsRevoked(redeemed.Claims) {
+		return nil, authz.RoomAccess{}, auth.ErrTokenRevoked
+	}
+	return redeemed.Claims, redeemed.Access, nil
+}
@@ -3,20 +3,47 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/afzalabbasi/message-service/pkg/realip"
 )
 
 // Config holds all configuration for the WebSocket service
 type Config struct {
-	ServerAddress      string
-	KafkaBrokers       []string
-	KafkaConsumerTopic string
-	KafkaProducerTopic string
-	KafkaGroupID       string
-	AuthServiceURL     string
-	JWTSecret          string
-	LogLevel           string
+	ServerAddress        string
+	KafkaBrokers         []string
+	KafkaConsumerTopic   string
+	KafkaProducerTopic   string
+	KafkaGroupID         string
+	KafkaUserEventsTopic string
+	KafkaAuditTopic      string
+	AuthServiceURL       string
+	LogLevel             string
+
+	// Expected iss and aud claims of access tokens, and the clock skew allowed when verifying them
+	JWTIssuer   string
+	JWTAudience string
+	JWTLeeway   time.Duration
+
+	// Whether connections may pass their token in the ?token= query parameter, which ends up
+	// in access logs; the alternatives are the subprotocol header, tickets and an auth frame
+	AllowQueryToken bool
+
+	// Time allowed for the auth frame of connections opened without credentials
+	AuthTimeout time.Duration
+
+	// Service client, with the rooms:admin scope, the service loads revocations and room
+	// sanctions from the auth service as; required
+	ServiceClientID     string
+	ServiceClientSecret string
+
+	// Proxies whose X-Forwarded-For and X-Real-IP headers are believed; other clients are
+	// known by the address they connect from
+	TrustedProxies []*net.IPNet
 }
 
 // Load loads configuration from environment variables
@@ -47,14 +74,70 @@ func Load() (*Config, error) {
 		kafkaGroupID = "websocket-service"
 	}
 
+	kafkaUserEventsTopic := os.Getenv("KAFKA_USER_EVENTS_TOPIC")
+	if kafkaUserEventsTopic == "" {
+		kafkaUserEventsTopic = "user-events"
+	}
+
+	kafkaAuditTopic := os.Getenv("KAFKA_AUDIT_TOPIC")
+	if kafkaAuditTopic == "" {
+		kafkaAuditTopic = "audit-events"
+	}
+
 	authServiceURL := os.Getenv("AUTH_SERVICE_URL")
 	if authServiceURL == "" {
 		authServiceURL = "http://auth-service:8081"
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET environment variable is required")
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "auth-service"
+	}
+
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "message-service"
+	}
+
+	jwtLeeway := 30 * time.Second
+	if v := os.Getenv("JWT_LEEWAY"); v != "" {
+		var err error
+		jwtLeeway, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_LEEWAY format: %v", err)
+		}
+	}
+
+	allowQueryToken := false
+	if v := os.Getenv("ALLOW_QUERY_TOKEN"); v != "" {
+		var err error
+		allowQueryToken, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALLOW_QUERY_TOKEN value: %v", err)
+		}
+	}
+
+	authTimeout := 10 * time.Second
+	if v := os.Getenv("WS_AUTH_TIMEOUT"); v != "" {
+		var err error
+		authTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WS_AUTH_TIMEOUT format: %v", err)
+		}
+	}
+
+	serviceClientID := os.Getenv("SERVICE_CLIENT_ID")
+	serviceClientSecret := os.Getenv("SERVICE_CLIENT_SECRET")
+	if serviceClientID == "" || serviceClientSecret == "" {
+		return nil, fmt.Errorf("SERVICE_CLIENT_ID and SERVICE_CLIENT_SECRET are required")
+	}
+
+	var trustedProxies []*net.IPNet
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		var err error
+		if trustedProxies, err = realip.ParseNetworks(v); err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES value: %v", err)
+		}
 	}
 
 	logLevel := os.Getenv("LOG_LEVEL")
@@ -63,13 +146,26 @@ func Load() (*Config, error) {
 	}
 
 	return &Config{
-		ServerAddress:      serverAddr,
-		KafkaBrokers:       kafkaBrokers,
-		KafkaConsumerTopic: kafkaConsumerTopic,
-		KafkaProducerTopic: kafkaProducerTopic,
-		KafkaGroupID:       kafkaGroupID,
-		AuthServiceURL:     authServiceURL,
-		JWTSecret:          jwtSecret,
-		LogLevel:           logLevel,
+		ServerAddress:        serverAddr,
+		KafkaBrokers:         kafkaBrokers,
+		KafkaConsumerTopic:   kafkaConsumerTopic,
+		KafkaProducerTopic:   kafkaProducerTopic,
+		KafkaGroupID:         kafkaGroupID,
+		KafkaUserEventsTopic: kafkaUserEventsTopic,
+		KafkaAuditTopic:      kafkaAuditTopic,
+		AuthServiceURL:       authServiceURL,
+		LogLevel:             logLevel,
+
+		JWTIssuer:   jwtIssuer,
+		JWTAudience: jwtAudience,
+		JWTLeeway:   jwtLeeway,
+
+		AllowQueryToken: allowQueryToken,
+		AuthTimeout:     authTimeout,
+
+		ServiceClientID:     serviceClientID,
+		ServiceClientSecret: serviceClientSecret,
+
+		TrustedProxies: trustedProxies,
 	}, nil
 }
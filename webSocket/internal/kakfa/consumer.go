@@ -4,7 +4,6 @@ package kafka
 import (
 	"context"
 	"encoding/json"
-	"github.com/afzalabbasi/message-service/webSocket/internal/api"
 	"github.com/afzalabbasi/message-service/webSocket/internal/config"
 	"github.com/afzalabbasi/message-service/webSocket/internal/models"
 	"github.com/segmentio/kafka-go"
@@ -12,6 +11,11 @@ import (
 	"time"
 )
 
+// Broadcaster delivers messages to the clients connected to a room
+type Broadcaster interface {
+	Broadcast(message models.Message, roomID string)
+}
+
 // Consumer represents a Kafka consumer
 type Consumer struct {
 	reader *kafka.Reader
@@ -35,7 +39,7 @@ func NewConsumer(cfg *config.Config) (*Consumer, error) {
 }
 
 // Consume consumes messages from Kafka and sends them to the WebSocket hub
-func (c *Consumer) Consume(hub *api.Hub) error {
+func (c *Consumer) Consume(hub Broadcaster) error {
 	for {
 		m, err := c.reader.ReadMessage(context.Background())
 		if err != nil {
@@ -57,6 +61,7 @@ func (c *Consumer) Consume(hub *api.Hub) error {
 			Content:   kafkaMsg.Content,
 			RoomID:    kafkaMsg.RoomID,
 			CreatedAt: kafkaMsg.Timestamp,
+			Bot:       kafkaMsg.Bot,
 		}
 
 		hub.Broadcast(message, kafkaMsg.RoomID)
@@ -14,6 +14,9 @@ import (
 // Producer represents a Kafka producer
 type Producer struct {
 	writer *kafka.Writer
+
+	// Writes to the audit events topic
+	audit *kafka.Writer
 }
 
 // NewProducer creates a new Kafka producer
@@ -26,8 +29,17 @@ func NewProducer(cfg *config.Config) (*Producer, error) {
 		Async:        false,
 	}
 
+	audit := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.KafkaBrokers...),
+		Topic:        cfg.KafkaAuditTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        false,
+	}
+
 	return &Producer{
 		writer: writer,
+		audit:  audit,
 	}, nil
 }
 
@@ -41,6 +53,7 @@ func (p *Producer) PublishMessage(message models.Message) error {
 		RoomID:    message.RoomID,
 		Timestamp: message.CreatedAt,
 		EventType: "message_created",
+		Bot:       message.Bot,
 	}
 
 	value, err := json.Marshal(kafkaMsg)
@@ -62,7 +75,32 @@ func (p *Producer) PublishMessage(message models.Message) error {
 	return nil
 }
 
+// PublishAuditEvent publishes an audit event to Kafka, keyed by actor
+func (p *Producer) PublishAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = p.audit.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(event.ActorID),
+			Value: value,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to write audit event to Kafka: %v", err)
+		return err
+	}
+
+	return nil
+}
+
 // Close closes the Kafka producer
 func (p *Producer) Close() error {
+	if err := p.audit.Close(); err != nil {
+		p.writer.Close()
+		return err
+	}
 	return p.writer.Close()
 }
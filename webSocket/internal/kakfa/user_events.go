@@ -0,0 +1,167 @@
+// internal/kafka/user_events.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/afzalabbasi/message-service/webSocket/internal/config"
+	"github.com/afzalabbasi/message-service/webSocket/internal/models"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"log"
+	"time"
+)
+
+// SessionManager controls the live sessions of connected users
+type SessionManager interface {
+	DisconnectUser(userID, reason string)
+	RevokeToken(tokenID string, expiresAt time.Time)
+	RevokeUserTokens(userID string, before time.Time)
+	RevokeSession(sessionID string, expiresAt time.Time)
+	RenameUser(userID, username string)
+	KickUser(roomID, userID, reason string)
+	BanUser(roomID, userID string, until time.Time, reason string)
+	UnbanUser(roomID, userID string)
+	MuteUser(roomID, userID string, until time.Time)
+	UnmuteUser(roomID, userID string)
+}
+
+// UserEventConsumer consumes user account events and applies them to live sessions
+type UserEventConsumer struct {
+	readers []*kafka.Reader
+}
+
+// NewUserEventConsumer creates a new Kafka consumer for the user events topic.
+// Every replica holds its own sessions, so each one has to see every event. Rather than
+// join a consumer group of its own, which would be abandoned at every restart, a replica
+// reads each partition directly from its latest offset; what happened before it started
+// is loaded from the auth service instead. Partitions added later are picked up at the
+// next restart.
+func NewUserEventConsumer(cfg *config.Config) (*UserEventConsumer, error) {
+	partitions, err := topicPartitions(cfg.KafkaBrokers, cfg.KafkaUserEventsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]*kafka.Reader, 0, len(partitions))
+	for _, partition := range partitions {
+		readers = append(readers, kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.KafkaBrokers,
+			Topic:       cfg.KafkaUserEventsTopic,
+			Partition:   partition.ID,
+			MinBytes:    1,
+			MaxBytes:    10e6, // 10MB
+			StartOffset: kafka.LastOffset,
+			MaxWait:     500 * time.Millisecond,
+		}))
+	}
+
+	return &UserEventConsumer{
+		readers: readers,
+	}, nil
+}
+
+// topicPartitions returns the partitions of topic, asking each broker in turn
+func topicPartitions(brokers []string, topic string) ([]kafka.Partition, error) {
+	var lastErr error
+	for _, broker := range brokers {
+		conn, err := kafka.Dial("tcp", broker)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		partitions, err := conn.ReadPartitions(topic)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("reading partitions of %s: %v", topic, lastErr)
+}
+
+// Consume consumes user events from every partition and applies them to the sessions
+// held by sessions. Events of a partition are applied in order.
+func (c *UserEventConsumer) Consume(sessions SessionManager) error {
+	errs := make(chan error, len(c.readers))
+	for _, reader := range c.readers {
+		go func(reader *kafka.Reader) {
+			errs <- consumePartition(reader, sessions)
+		}(reader)
+	}
+	return <-errs
+}
+
+// consumePartition applies the user events read by reader until it is closed
+func consumePartition(reader *kafka.Reader, sessions SessionManager) error {
+	for {
+		m, err := reader.ReadMessage(context.Background())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Error reading user event: %v", err)
+			continue
+		}
+
+		var event models.UserEvent
+		if err := json.Unmarshal(m.Value, &event); err != nil {
+			log.Printf("Error unmarshaling user event: %v", err)
+			continue
+		}
+
+		switch event.EventType {
+		case models.EventUserDeleted:
+			sessions.DisconnectUser(event.UserID, "account deleted")
+		case models.EventTokenRevoked:
+			// Keep revocations without an expiry for a day, longer than any access token lives
+			expiresAt := time.Now().Add(24 * time.Hour)
+			if event.ExpiresAt != nil {
+				expiresAt = *event.ExpiresAt
+			}
+			sessions.RevokeToken(event.TokenID, expiresAt)
+		case models.EventUserTokensRevoked:
+			sessions.RevokeUserTokens(event.UserID, event.Timestamp)
+		case models.EventSessionRevoked:
+			expiresAt := time.Now().Add(24 * time.Hour)
+			if event.ExpiresAt != nil {
+				expiresAt = *event.ExpiresAt
+			}
+			sessions.RevokeSession(event.SessionID, expiresAt)
+		case models.EventUsernameChanged:
+			sessions.RenameUser(event.UserID, event.Username)
+		case models.EventRoomUserKicked:
+			sessions.KickUser(event.RoomID, event.UserID, event.Reason)
+		case models.EventRoomUserBanned:
+			// Bans without an expiry are permanent
+			var until time.Time
+			if event.ExpiresAt != nil {
+				until = *event.ExpiresAt
+			}
+			sessions.BanUser(event.RoomID, event.UserID, until, event.Reason)
+		case models.EventRoomUserUnbanned:
+			sessions.UnbanUser(event.RoomID, event.UserID)
+		case models.EventRoomUserMuted:
+			if event.ExpiresAt == nil {
+				log.Printf("Ignoring mute of %s in %s without an expiry", event.UserID, event.RoomID)
+				continue
+			}
+			sessions.MuteUser(event.RoomID, event.UserID, *event.ExpiresAt)
+		case models.EventRoomUserUnmuted:
+			sessions.UnmuteUser(event.RoomID, event.UserID)
+		}
+	}
+}
+
+// Close closes the Kafka consumer
+func (c *UserEventConsumer) Close() error {
+	var firstErr error
+	for _, reader := range c.readers {
+		if err := reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
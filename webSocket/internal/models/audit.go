@@ -0,0 +1,33 @@
+// internal/models/audit.go
+package models
+
+import (
+	"time"
+)
+
+// AuditService names the WebSocket service as the source of its audit events
+const AuditService = "websocket-service"
+
+// Audit actions published by the WebSocket service
+const (
+	// A connection attempt was refused; the reason detail says why
+	AuditConnectionRejected = "connection_rejected"
+
+	// An open connection was closed because its token was revoked
+	AuditConnectionRevoked = "connection_revoked"
+)
+
+// AuditEvent records a security-relevant action for the audit log
+type AuditEvent struct {
+	EventID   string    `json:"event_id"`
+	Service   string    `json:"service"`
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actor_id,omitempty"`  // user or client that acted; empty if not authenticated
+	TargetID  string    `json:"target_id,omitempty"` // user the action was taken on, if not the actor
+	RoomID    string    `json:"room_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Action-specific details, e.g. why a connection was rejected
+	Details map[string]string `json:"details,omitempty"`
+}
@@ -13,6 +13,11 @@ type Message struct {
 	Content   string    `json:"content"`
 	RoomID    string    `json:"room_id"`
 	CreatedAt time.Time `json:"created_at"`
+	Bot       bool      `json:"bot,omitempty"` // sent by a service client rather than a user
+
+	// Set to "error" on notices sent only to the client that caused them, such as a
+	// rejected send from a muted user; empty for chat messages
+	Type string `json:"type,omitempty"`
 }
 
 // KafkaMessage represents a message that is published/consumed to/from Kafka
@@ -24,4 +29,45 @@ type KafkaMessage struct {
 	RoomID    string    `json:"room_id"`
 	Timestamp time.Time `json:"timestamp"`
 	EventType string    `json:"event_type"` // e.g., "message_created", "message_updated"
+	Bot       bool      `json:"bot,omitempty"`
+}
+
+// User event types consumed from the user events topic
+const (
+	EventUserDeleted       = "user_deleted"
+	EventTokenRevoked      = "token_revoked"
+	EventUserTokensRevoked = "user_tokens_revoked"
+	EventSessionRevoked    = "session_revoked"
+	EventUsernameChanged   = "username_changed"
+
+	// Room moderation; RoomID names the room and ExpiresAt, if set, when a ban or mute ends
+	EventRoomUserKicked   = "room_user_kicked"
+	EventRoomUserBanned   = "room_user_banned"
+	EventRoomUserUnbanned = "room_user_unbanned"
+	EventRoomUserMuted    = "room_user_muted"
+	EventRoomUserUnmuted  = "room_user_unmuted"
+)
+
+// UserEvent is published by the auth service when something happens to a user account
+type UserEvent struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"` // e.g., "user_deleted"
+	UserID    string    `json:"user_id"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"` // for user_tokens_revoked, tokens issued before this are revoked
+
+	// Set on token_revoked events; on session_revoked events ExpiresAt is when the last
+	// token issued to the session expires
+	TokenID   string     `json:"token_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Set on session_revoked events
+	SessionID string `json:"session_id,omitempty"`
+
+	// Set on username_changed events to the new username
+	Username string `json:"username,omitempty"`
+
+	// Set on room moderation events
+	RoomID string `json:"room_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }